@@ -0,0 +1,107 @@
+package microweb
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// constraintShorthands are the named patterns accepted in {name:pattern}
+var constraintShorthands = map[string]string{
+	"int":   `-?[0-9]+`,
+	"uint":  `[0-9]+`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+	"alpha": `[a-zA-Z]+`,
+	"alnum": `[a-zA-Z0-9]+`,
+	"slug":  `[a-z0-9]+(?:-[a-z0-9]+)*`,
+}
+
+// paramConstraint restricts a path parameter to a pattern
+type paramConstraint struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// parseConstraints strips {name:pattern} constraints from path, returning
+// the plain ServeMux pattern and the constraints to check. pattern is one of
+// the shorthands (int, uint, uuid, alpha, alnum, slug) or a regular
+// expression that must match the whole segment. Invalid expressions panic,
+// like invalid ServeMux patterns.
+func parseConstraints(path string) (string, []paramConstraint) {
+	if !strings.Contains(path, ":") {
+		return path, nil
+	}
+
+	var b strings.Builder
+	var constraints []paramConstraint
+
+	for i := 0; i < len(path); i++ {
+		if path[i] != '{' {
+			b.WriteByte(path[i])
+			continue
+		}
+
+		// Find the matching brace; regexes may contain {n,m}
+		depth, end := 0, -1
+		for j := i; j < len(path) && end < 0; j++ {
+			switch path[j] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					end = j
+				}
+			}
+		}
+		if end < 0 {
+			b.WriteString(path[i:])
+			break
+		}
+
+		name, pattern, ok := strings.Cut(path[i+1:end], ":")
+		if ok {
+			if short, found := constraintShorthands[pattern]; found {
+				pattern = short
+			}
+			constraints = append(constraints, paramConstraint{
+				name: strings.TrimSuffix(name, "..."),
+				re:   regexp.MustCompile("^(?:" + pattern + ")$"),
+			})
+		}
+		b.WriteString("{" + name + "}")
+		i = end
+	}
+
+	return b.String(), constraints
+}
+
+// constrain wraps next so requests whose path parameters don't satisfy the
+// constraints get the router's not-found response
+func (mw *Router) constrain(constraints []paramConstraint, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, c := range constraints {
+			if !c.re.MatchString(r.PathValue(c.name)) {
+				mw.serveNotFound(w, r)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// serveNotFound responds with the custom not-found handler or a plain 404
+func (mw *Router) serveNotFound(w http.ResponseWriter, r *http.Request) {
+	handler := mw.notFoundHandlerFor(r.URL.Path)
+	if handler == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if crw, ok := w.(*customResponseWriter); ok {
+		crw.handled = true
+	}
+	ctx := mw.newContext(w, r)
+	handler(ctx)
+	mw.releaseContext(ctx)
+}
@@ -1,45 +1,223 @@
 package microweb
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"mime/multipart"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ErrBodyTooLarge is returned by body and multipart helpers when the request
+// body exceeds the limit set with SetMaxBodySize
+var ErrBodyTooLarge = errors.New("microweb: request body too large")
+
+// ErrUploadAborted is returned by upload helpers when the client disconnects
+// or cancels the request before the body has been received
+var ErrUploadAborted = errors.New("microweb: upload aborted")
+
+// ErrJSONTooDeep is returned by Parse when the body nests deeper than the
+// limit set with SetMaxJSONDepth
+var ErrJSONTooDeep = errors.New("microweb: JSON nesting too deep")
+
+// Context carries a single request through the handler chain. Contexts are
+// pooled and reused, so a Context must not be retained after the handler
+// chain returns.
 type Context struct {
 	R          *http.Request
 	W          http.ResponseWriter
+	rw         http.ResponseWriter // W before middleware wrapped it
 	Method     string
 	formparsed bool
 	state      map[string]any
+	recovered  any
+	oncomplete []func(*Context)
+	aborted    atomic.Bool
+	router     *Router
+	group      *Group
+	body       []byte
+	bodyread   bool
+}
+
+var contextPool = sync.Pool{
+	New: func() any { return new(Context) },
 }
 
+// reset clears the context so it can be returned to the pool
+func (tc *Context) reset() {
+	tc.R = nil
+	tc.W = nil
+	tc.rw = nil
+	tc.Method = ""
+	tc.formparsed = false
+	tc.state = nil
+	tc.recovered = nil
+	clear(tc.oncomplete)
+	tc.oncomplete = tc.oncomplete[:0]
+	tc.aborted.Store(false)
+	tc.router = nil
+	tc.group = nil
+	tc.body = nil
+	tc.bodyread = false
+}
+
+// Json writes v as JSON, after passing it through the router's JSON post
+// processor when one is set
 func (tc *Context) Json(v any) error {
+	if tc.router != nil && tc.router.jsonPostProcessor != nil {
+		v = tc.router.jsonPostProcessor(tc, v)
+	}
+	return tc.JsonRaw(v)
+}
+
+// JsonRaw writes v as JSON without the router's JSON post processor
+func (tc *Context) JsonRaw(v any) error {
+	return tc.writeJSON(v, tc.router != nil && tc.router.prettyJSON)
+}
+
+// JsonPretty writes v as JSON indented with two spaces, like Json
+func (tc *Context) JsonPretty(v any) error {
+	if tc.router != nil && tc.router.jsonPostProcessor != nil {
+		v = tc.router.jsonPostProcessor(tc, v)
+	}
+	return tc.writeJSON(v, true)
+}
+
+// writeJSON encodes v to the response, indented when pretty is set
+func (tc *Context) writeJSON(v any, pretty bool) error {
 	tc.W.Header().Set("Content-Type", "application/json")
-	return json.NewEncoder(tc.W).Encode(v)
+	enc := json.NewEncoder(tc.W)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(v)
+}
+
+// Xml writes v as an XML document with an XML declaration
+func (tc *Context) Xml(v any) error {
+	tc.W.Header().Set("Content-Type", "application/xml")
+	if _, err := io.WriteString(tc.W, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(tc.W).Encode(v)
+}
+
+// IsSecure reports whether the request arrived over TLS, either directly or
+// through a trusted proxy that set X-Forwarded-Proto: https
+func (tc *Context) IsSecure() bool {
+	if tc.R.TLS != nil {
+		return true
+	}
+
+	return tc.router != nil && tc.router.isTrustedProxy(tc.R.RemoteAddr) &&
+		strings.EqualFold(tc.R.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// ClientIP returns the client's IP address. The headers set with
+// SetClientIPHeaders (X-Forwarded-For first hop, then X-Real-IP by default)
+// are only honored for requests from trusted proxies; otherwise the host of
+// RemoteAddr is used, which is already the real client when serving through
+// a PROXY protocol listener (see Router.Serve).
+func (tc *Context) ClientIP() string {
+	if tc.router != nil && tc.router.isTrustedProxy(tc.R.RemoteAddr) {
+		for _, header := range tc.router.clientIPHeaders {
+			first, _, _ := strings.Cut(tc.R.Header.Get(header), ",")
+			if ip := strings.TrimSpace(first); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(tc.R.RemoteAddr)
+	if err != nil {
+		return tc.R.RemoteAddr
+	}
+	return host
 }
 
 func (tc *Context) Query(key string) string {
 	return tc.R.URL.Query().Get(key)
 }
 
+// QueryTime parses the query parameter key as a time using layout, or
+// RFC3339 when layout is empty
+func (tc *Context) QueryTime(key, layout string) (time.Time, error) {
+	raw := tc.Query(key)
+	if raw == "" {
+		return time.Time{}, fmt.Errorf("microweb: query parameter %q is missing", key)
+	}
+
+	if layout == "" {
+		layout = time.RFC3339
+	}
+
+	t, err := time.Parse(layout, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("microweb: query parameter %q: invalid time %q, expected format %s", key, raw, layout)
+	}
+	return t, nil
+}
+
+// QueryDateRange parses two query parameters as RFC3339 times or dates
+// (2006-01-02) and checks that from is not after to. A missing bound is
+// returned as the zero time.
+func (tc *Context) QueryDateRange(fromKey, toKey string) (from, to time.Time, err error) {
+	parse := func(key string) (time.Time, error) {
+		if tc.Query(key) == "" {
+			return time.Time{}, nil
+		}
+		if t, err := tc.QueryTime(key, time.RFC3339); err == nil {
+			return t, nil
+		}
+		return tc.QueryTime(key, time.DateOnly)
+	}
+
+	if from, err = parse(fromKey); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if to, err = parse(toKey); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	if !from.IsZero() && !to.IsZero() && from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("microweb: %q must not be after %q", fromKey, toKey)
+	}
+	return from, to, nil
+}
+
 func (tc *Context) Status(status int) {
 	tc.W.WriteHeader(status)
 }
 
+// View parses and executes a single template file on every call, for
+// one-off pages. Functions set with SetTemplateFuncs are available, but the
+// layout is not applied; use LoadTemplates and Render for that.
 func (c *Context) View(filename string, data interface{}) error {
 	body, err := os.ReadFile(filename)
 	if err != nil {
 		return err
 	}
 
-	t, err := template.New(filename).Parse(string(body))
+	t := template.New(filename)
+	if c.router != nil {
+		c.router.templates.mu.RLock()
+		t.Funcs(c.router.templateFuncs())
+		c.router.templates.mu.RUnlock()
+	}
+	t, err = t.Parse(string(body))
 	if err != nil {
 		return err
 	}
@@ -51,10 +229,34 @@ func (c *Context) Param(key string) string {
 	return c.R.PathValue(key)
 }
 
+// Header returns the first value of the request header key. The key is
+// case-insensitive: it is canonicalized, so "x-api-key" finds "X-Api-Key".
+// The value is returned as sent.
 func (c *Context) Header(key string) string {
 	return c.R.Header.Get(key)
 }
 
+// HeaderTrimmed returns the request header key with surrounding whitespace
+// removed, for values padded by proxies
+func (c *Context) HeaderTrimmed(key string) string {
+	return strings.TrimSpace(c.R.Header.Get(key))
+}
+
+// IfMatch returns the If-Match request header
+func (tc *Context) IfMatch() string {
+	return tc.R.Header.Get("If-Match")
+}
+
+// IfNoneMatch returns the If-None-Match request header
+func (tc *Context) IfNoneMatch() string {
+	return tc.R.Header.Get("If-None-Match")
+}
+
+// PreconditionFailed responds with 412 Precondition Failed
+func (tc *Context) PreconditionFailed() {
+	tc.W.WriteHeader(http.StatusPreconditionFailed)
+}
+
 func (tc *Context) StatusOk() {
 	tc.W.WriteHeader(http.StatusOK)
 }
@@ -71,6 +273,35 @@ func (tc *Context) Redirect(url string, code int) {
 	http.Redirect(tc.W, tc.R, url, code)
 }
 
+// RedirectPermanent redirects to url with 301 Moved Permanently
+func (tc *Context) RedirectPermanent(url string) {
+	tc.Redirect(url, http.StatusMovedPermanently)
+}
+
+// RedirectTemporary redirects to url with 302 Found
+func (tc *Context) RedirectTemporary(url string) {
+	tc.Redirect(url, http.StatusFound)
+}
+
+// RedirectWithQuery redirects to target with 302 Found after adding params
+// to its query string. Existing query parameters are kept; params replace
+// any with the same name.
+func (tc *Context) RedirectWithQuery(target string, params map[string]string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+
+	query := u.Query()
+	for k, v := range params {
+		query.Set(k, v)
+	}
+	u.RawQuery = query.Encode()
+
+	tc.Redirect(u.String(), http.StatusFound)
+	return nil
+}
+
 func (tc *Context) SetCookie(cookie *http.Cookie) {
 	http.SetCookie(tc.W, cookie)
 }
@@ -79,17 +310,38 @@ func (tc *Context) Cookie(name string) (*http.Cookie, error) {
 	return tc.R.Cookie(name)
 }
 
+// Cookies returns all cookies sent with the request
+func (tc *Context) Cookies() []*http.Cookie {
+	return tc.R.Cookies()
+}
+
 func (tc *Context) Context() context.Context {
 	return tc.R.Context()
 }
 
+// Flush sends any buffered response data to the client, if the writer
+// supports it
+func (tc *Context) Flush() {
+	if f, ok := tc.W.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func (tc *Context) FormFile(name string) (multipart.File, *multipart.FileHeader, error) {
-	return tc.R.FormFile(name)
+	file, header, err := tc.R.FormFile(name)
+	return file, header, tc.uploadError(bodyError(err))
 }
 
 func (tc *Context) SaveUploadedFile(file multipart.File, fileHeader *multipart.FileHeader, dst string) error {
 	defer file.Close()
+	return tc.SaveStream(file, dst)
+}
 
+// SaveStream copies r to the file dst, creating its directory. The copy stops
+// as soon as the request is cancelled, for example because the client
+// disconnected. If the copy fails the partial file is removed, and errors
+// caused by the client going away wrap ErrUploadAborted.
+func (tc *Context) SaveStream(r io.Reader, dst string) error {
 	// Create the destination directory if it doesn't exist
 	dir := filepath.Dir(dst)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -101,21 +353,146 @@ func (tc *Context) SaveUploadedFile(file multipart.File, fileHeader *multipart.F
 	if err != nil {
 		return err
 	}
-	defer out.Close()
 
-	// Copy the uploaded file to the destination
-	_, err = io.Copy(out, file)
+	// Copy the upload to the destination, stopping on cancellation
+	_, err = io.Copy(out, &contextReader{ctx: tc.Context(), r: r})
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return tc.uploadError(bodyError(err))
+	}
+	return nil
+}
+
+// contextReader stops reading once its context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// uploadError marks errors caused by the client going away mid-upload with
+// ErrUploadAborted
+func (tc *Context) uploadError(err error) error {
+	if err == nil || errors.Is(err, ErrUploadAborted) {
+		return err
+	}
+	if tc.Context().Err() != nil || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %w", ErrUploadAborted, err)
+	}
 	return err
 }
 
 func (tc *Context) MultipartForm() (*multipart.Form, error) {
 	if err := tc.R.ParseMultipartForm(32 << 20); err != nil { // 32 MB max memory
-		return nil, err
+		return nil, tc.uploadError(bodyError(err))
 	}
 	return tc.R.MultipartForm, nil
 }
 
+// StatusCode returns the status code written to the response so far
+func (tc *Context) StatusCode() int {
+	if sr, ok := tc.W.(statusReporter); ok {
+		return sr.Status()
+	}
+	return http.StatusOK
+}
+
+// Written reports whether the response header has been written
+func (tc *Context) Written() bool {
+	if sr, ok := tc.W.(statusReporter); ok {
+		return sr.Written()
+	}
+	return false
+}
+
+// Abort stops the remaining handlers and middlewares in the chain from running
+func (tc *Context) Abort() {
+	tc.aborted.Store(true)
+}
+
+// IsAborted reports whether Abort has been called
+func (tc *Context) IsAborted() bool {
+	return tc.aborted.Load()
+}
+
+// Panicked reports whether the handler chain panicked
+func (tc *Context) Panicked() bool {
+	return tc.recovered != nil
+}
+
+// OnComplete registers a function to run once the handler chain has finished,
+// including when it panicked. Functions run in reverse order of registration.
+func (tc *Context) OnComplete(fn func(c *Context)) {
+	tc.oncomplete = append(tc.oncomplete, fn)
+}
+
+// complete runs the registered completion functions
+func (tc *Context) complete() {
+	for i := len(tc.oncomplete) - 1; i >= 0; i-- {
+		tc.oncomplete[i](tc)
+	}
+	tc.oncomplete = nil
+}
+
+// MultipartReader returns a streaming reader over the multipart body
+func (tc *Context) MultipartReader() (*multipart.Reader, error) {
+	return tc.R.MultipartReader()
+}
+
+// SingleFilePart returns the first file part of a streaming multipart body so
+// a single large upload can be piped to storage without parsing the whole form.
+// Form fields before the file are skipped and fields after it are not accessible.
+func (tc *Context) SingleFilePart() (*multipart.Part, error) {
+	mr, err := tc.R.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, http.ErrMissingFile
+		}
+		if err != nil {
+			return nil, tc.uploadError(bodyError(err))
+		}
+
+		if part.FileName() != "" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// IsBodyTooLarge reports whether err was caused by the request body
+// exceeding the router's SetMaxBodySize limit, so handlers can respond 413
+func (tc *Context) IsBodyTooLarge(err error) bool {
+	var mbe *http.MaxBytesError
+	return errors.Is(err, ErrBodyTooLarge) || errors.As(err, &mbe)
+}
+
+// bodyError marks errors caused by the body size limit with ErrBodyTooLarge
+func bodyError(err error) error {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) && !errors.Is(err, ErrBodyTooLarge) {
+		return fmt.Errorf("%w: %w", ErrBodyTooLarge, err)
+	}
+	return err
+}
+
 func (tc *Context) Set(k string, v any) {
+	if tc.state == nil {
+		tc.state = make(map[string]any)
+	}
 	tc.state[k] = v
 }
 
@@ -127,23 +504,73 @@ func (tc *Context) Get(k string) any {
 	return nil
 }
 
+// Parse decodes the JSON request body into target. It works for any method,
+// including GET and DELETE requests that carry a body.
 func (tc *Context) Parse(target any) error {
-	body, err := io.ReadAll(tc.R.Body)
+	body, err := tc.Body()
 	if err != nil {
 		return err
 	}
-	defer tc.R.Body.Close()
+
+	if tc.router != nil && tc.router.maxJSONDepth > 0 {
+		if err := checkJSONDepth(body, tc.router.maxJSONDepth); err != nil {
+			return err
+		}
+	}
 
 	return json.Unmarshal(body, target)
 }
 
+// checkJSONDepth scans data and fails if objects and arrays nest deeper than max
+func checkJSONDepth(data []byte, max int) error {
+	depth := 0
+	inString := false
+	escaped := false
+
+	for _, b := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case b == '\\':
+				escaped = true
+			case b == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch b {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			if depth > max {
+				return ErrJSONTooDeep
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+	return nil
+}
+
+// Body returns the request body. The body is buffered on first read so Body,
+// Parse and later readers of R.Body all see the same bytes regardless of method.
 func (tc *Context) Body() ([]byte, error) {
+	if tc.bodyread {
+		return tc.body, nil
+	}
+
 	body, err := io.ReadAll(tc.R.Body)
+	tc.R.Body.Close()
 	if err != nil {
-		return nil, err
+		return nil, bodyError(err)
 	}
-	defer tc.R.Body.Close()
 
+	tc.body = body
+	tc.bodyread = true
+	tc.R.Body = io.NopCloser(bytes.NewReader(body))
 	return body, nil
 }
 
@@ -0,0 +1,110 @@
+package microweb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseJSONBodyOnAnyMethod(t *testing.T) {
+	type query struct {
+		Term string `json:"term"`
+		Size int    `json:"size"`
+	}
+
+	r := New()
+	handler := func(c *Context) {
+		var q query
+		if err := c.Parse(&q); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		// The body stays readable after Parse
+		body, _ := c.Body()
+		c.Json(map[string]any{"term": q.Term, "size": q.Size, "raw": len(body)})
+	}
+	r.Get("/search", handler)
+	r.Delete("/search", handler)
+
+	payload := `{"term":"go","size":3}`
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		req := httptest.NewRequest(method, "/search", strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		want := `{"raw":22,"size":3,"term":"go"}` + "\n"
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("%s: got %d %q, want 200 %q", method, w.Code, w.Body.String(), want)
+		}
+	}
+}
+
+func TestBindJSONBodyOnGet(t *testing.T) {
+	var got struct {
+		Name string `json:"name"`
+	}
+
+	r := New()
+	r.Get("/bind", func(c *Context) {
+		if err := c.Bind(&got); err != nil {
+			t.Errorf("Bind: %v", err)
+		}
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/bind", strings.NewReader(`{"name":"ada"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got.Name != "ada" {
+		t.Errorf("Name = %q, want ada", got.Name)
+	}
+}
+
+func TestBodySizeLimitAppliesToGet(t *testing.T) {
+	r := New()
+	r.SetMaxBodySize(8)
+
+	var tooLarge bool
+	r.Get("/search", func(c *Context) {
+		_, err := c.Body()
+		tooLarge = c.IsBodyTooLarge(err)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/search", strings.NewReader(`{"term":"too long"}`))
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !tooLarge {
+		t.Error("body over the limit on a GET was not rejected")
+	}
+}
+
+func TestHeaderTrimmed(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"Bearer abc", "Bearer abc"},
+		{"  Bearer abc", "Bearer abc"},
+		{"Bearer abc ", "Bearer abc"},
+		{"\tBearer abc \t", "Bearer abc"},
+		{"   ", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		// Set the value directly, as a proxy or middleware in the same
+		// process would, since net/http trims values read off the wire
+		req.Header["Authorization"] = []string{tt.value}
+		c := &Context{R: req}
+
+		// Keys are canonicalized, so any casing finds the header
+		for _, key := range []string{"Authorization", "authorization", "AUTHORIZATION"} {
+			if got := c.HeaderTrimmed(key); got != tt.want {
+				t.Errorf("HeaderTrimmed(%q) with value %q = %q, want %q", key, tt.value, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package microweb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrInvalidCookie is returned when a signed or encrypted cookie is
+// malformed, was tampered with or was made with a different secret
+var ErrInvalidCookie = errors.New("microweb: invalid or tampered cookie")
+
+// SetSignedCookie sets a cookie whose value is signed with HMAC-SHA256 so
+// the client can read but not modify it. The signature covers the cookie
+// name, so a value can't be moved to another cookie. The cookie is HttpOnly,
+// SameSite=Lax, scoped to "/" and Secure on HTTPS requests.
+func (tc *Context) SetSignedCookie(name, value, secret string, maxAge int) {
+	enc := base64.RawURLEncoding
+	sig := cookieMAC(secret, name, value)
+	tc.setSecureCookie(name, enc.EncodeToString([]byte(value))+"."+enc.EncodeToString(sig), maxAge)
+}
+
+// SignedCookie returns the value of a cookie set with SetSignedCookie. It
+// returns http.ErrNoCookie when the cookie is missing and ErrInvalidCookie
+// when the signature does not match.
+func (tc *Context) SignedCookie(name, secret string) (string, error) {
+	cookie, err := tc.R.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+
+	data, sig, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return "", ErrInvalidCookie
+	}
+
+	enc := base64.RawURLEncoding
+	value, err := enc.DecodeString(data)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	got, err := enc.DecodeString(sig)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+
+	if !hmac.Equal(got, cookieMAC(secret, name, string(value))) {
+		return "", ErrInvalidCookie
+	}
+	return string(value), nil
+}
+
+// SetEncryptedCookie sets a cookie whose value is encrypted and
+// authenticated with AES-256-GCM, using a key derived from secret, so the
+// client can neither read nor modify it. Cookie attributes match
+// SetSignedCookie.
+func (tc *Context) SetEncryptedCookie(name, value, secret string, maxAge int) error {
+	aead, err := cookieAEAD(secret)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	tc.setSecureCookie(name, base64.RawURLEncoding.EncodeToString(sealed), maxAge)
+	return nil
+}
+
+// EncryptedCookie returns the value of a cookie set with SetEncryptedCookie.
+// It returns http.ErrNoCookie when the cookie is missing and ErrInvalidCookie
+// when it can't be decrypted.
+func (tc *Context) EncryptedCookie(name, secret string) (string, error) {
+	cookie, err := tc.R.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := cookieAEAD(secret)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrInvalidCookie
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	value, err := aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	return string(value), nil
+}
+
+// setSecureCookie sets a cookie with the attributes shared by signed and
+// encrypted cookies
+func (tc *Context) setSecureCookie(name, value string, maxAge int) {
+	http.SetCookie(tc.W, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   tc.IsSecure(),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// cookieMAC signs a cookie name and value
+func cookieMAC(secret, name, value string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// cookieAEAD derives an AES-256-GCM cipher from secret
+func cookieAEAD(secret string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte("microweb cookie encryption\x00" + secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
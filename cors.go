@@ -0,0 +1,72 @@
+package microweb
+
+import "net/http"
+
+// CORS applies CORS headers to every route in the group and its child
+// groups, ahead of the group's other middleware so error responses carry
+// them too. Browsers send preflight OPTIONS requests to the target path, so an
+// OPTIONS route is registered for each of the group's paths, including
+// routes added before CORS was called. Preflight requests run only the CORS
+// middleware, not the rest of the group chain, so auth middleware doesn't
+// reject them. Paths that already have an OPTIONS route outside the group
+// keep it; custom OPTIONS handlers must be registered before other routes on
+// the same path, which Any and Match do for you. OPTIONS routes inside the group are answered by the CORS
+// middleware before their handler runs.
+func (g *Group) CORS(allowOrigin, allowMethods, allowHeaders string) {
+	g.cors = CORS(allowOrigin, allowMethods, allowHeaders)
+	g.middleware = append([]MiddleWare{g.cors}, g.middleware...)
+
+	for _, rt := range g.r.table {
+		if rt.group != nil && rt.group.within(g) {
+			g.r.preflight(rt.Path, rt.group.corsMiddleware())
+		}
+	}
+}
+
+// Preflight registers an OPTIONS route at the route's path that answers
+// preflight requests with cors. Use it with the same middleware passed to
+// GetWith and friends so a single route can have its own CORS policy:
+//
+//	cors := microweb.CORS("*", "GET", "Content-Type")
+//	router.GetWith("/public/status", status, cors).Preflight(cors)
+func (rt *Route) Preflight(cors MiddleWare) *Route {
+	rt.router.preflight(rt.Path, cors)
+	return rt
+}
+
+// preflight registers an OPTIONS route for path running only cors, unless
+// the path already has one
+func (mw *Router) preflight(path string, cors MiddleWare) {
+	for _, rt := range mw.table {
+		if rt.Method == http.MethodOptions && rt.Path == path {
+			return
+		}
+	}
+
+	mw.Options(path, func(c *Context) {
+		if cors(c) && !c.Written() {
+			c.W.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
+
+// corsMiddleware returns the CORS middleware of the nearest group in the
+// chain that has one, or nil
+func (g *Group) corsMiddleware() MiddleWare {
+	for ; g != nil; g = g.parent {
+		if g.cors != nil {
+			return g.cors
+		}
+	}
+	return nil
+}
+
+// within reports whether g is ancestor or one of its descendants
+func (g *Group) within(ancestor *Group) bool {
+	for ; g != nil; g = g.parent {
+		if g == ancestor {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package microweb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func denyAll(c *Context) bool {
+	c.W.WriteHeader(http.StatusUnauthorized)
+	return false
+}
+
+func serve(r *Router, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Origin", "https://app.test")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestGroupCORSPreflight(t *testing.T) {
+	r := New()
+	ok := func(c *Context) { c.String("ok") }
+
+	api := r.Group("/api")
+	api.Get("/before", ok) // registered before CORS
+	api.Use(denyAll)
+	api.CORS("https://app.test", "GET, POST", "Content-Type")
+	api.Post("/after", ok)
+	api.Group("/v1").Get("/nested", ok)
+
+	r.Get("/public", ok)
+
+	for _, path := range []string{"/api/before", "/api/after", "/api/v1/nested"} {
+		w := serve(r, http.MethodOptions, path)
+		if w.Code != http.StatusNoContent {
+			t.Errorf("OPTIONS %s: status = %d, want 204 without running auth", path, w.Code)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.test" {
+			t.Errorf("OPTIONS %s: Allow-Origin = %q", path, got)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST" {
+			t.Errorf("OPTIONS %s: Allow-Methods = %q", path, got)
+		}
+	}
+
+	// Rejected requests still carry CORS headers so browsers can read them
+	w := serve(r, http.MethodPost, "/api/after")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("POST /api/after: status = %d, want 401", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.test" {
+		t.Errorf("POST /api/after: Allow-Origin = %q on 401", got)
+	}
+
+	// Routes outside the group get no CORS headers and no preflight route
+	w = serve(r, http.MethodGet, "/public")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("GET /public: Allow-Origin = %q, want none", got)
+	}
+	w = serve(r, http.MethodOptions, "/public")
+	if w.Code == http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("OPTIONS /public: got %d with Allow-Origin %q, want no preflight",
+			w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestRoutePreflight(t *testing.T) {
+	r := New()
+	cors := CORS("*", "GET", "Content-Type")
+	r.GetWith("/status", func(c *Context) { c.String("up") }, cors).Preflight(cors)
+	r.Get("/other", func(c *Context) { c.String("other") })
+
+	w := serve(r, http.MethodOptions, "/status")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("OPTIONS /status: got %d with Allow-Origin %q", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	w = serve(r, http.MethodGet, "/status")
+	if w.Body.String() != "up" || w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("GET /status: got %q with Allow-Origin %q", w.Body.String(), w.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	w = serve(r, http.MethodGet, "/other")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("GET /other: Allow-Origin = %q, want none", got)
+	}
+}
+
+func TestPreflightKeepsExistingOptionsRoute(t *testing.T) {
+	r := New()
+	r.Options("/api/items", func(c *Context) { c.String("custom") })
+	api := r.Group("/api")
+	api.Get("/items", func(c *Context) {})
+	api.CORS("*", "GET", "")
+
+	w := serve(r, http.MethodOptions, "/api/items")
+	if w.Body.String() != "custom" {
+		t.Errorf("OPTIONS /api/items: body = %q, want the custom handler", w.Body.String())
+	}
+}
+
+func TestCORSGroupAnyAndMatchWithOptions(t *testing.T) {
+	r := New()
+	ok := func(c *Context) { c.String("ok") }
+
+	api := r.Group("/api")
+	api.CORS("https://app.test", "GET, POST", "Content-Type")
+	api.Any("/any", ok)
+	api.Match([]string{http.MethodGet, http.MethodOptions}, "/match", ok)
+
+	for _, path := range []string{"/api/any", "/api/match"} {
+		w := serve(r, http.MethodGet, path)
+		if w.Code != http.StatusOK || w.Body.String() != "ok" {
+			t.Errorf("GET %s: got %d %q", path, w.Code, w.Body.String())
+		}
+		w = serve(r, http.MethodOptions, path)
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.test" {
+			t.Errorf("OPTIONS %s: Allow-Origin = %q", path, got)
+		}
+	}
+}
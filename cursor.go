@@ -0,0 +1,109 @@
+package microweb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidCursor is returned when a cursor is malformed or its signature
+// does not match
+var ErrInvalidCursor = errors.New("microweb: invalid cursor")
+
+// errNoCursorSecret is returned by the Context cursor helpers when
+// SetCursorSecret has not been called
+var errNoCursorSecret = errors.New("microweb: cursor secret not set")
+
+// EncodeCursor encodes v as an opaque, URL-safe cursor signed with secret so
+// clients cannot tamper with it. Cursors are signed, not encrypted; don't
+// put secrets in them.
+func EncodeCursor(secret []byte, v any) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(mac.Sum(nil)), nil
+}
+
+// DecodeCursor verifies a cursor made by EncodeCursor and decodes it into v
+func DecodeCursor(secret []byte, cursor string, v any) error {
+	data, sig, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return ErrInvalidCursor
+	}
+
+	enc := base64.RawURLEncoding
+	payload, err := enc.DecodeString(data)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	got, err := enc.DecodeString(sig)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(payload, v); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+// SetCursorSecret sets the key used to sign pagination cursors. Use the same
+// secret on every instance serving the API.
+func (r *Router) SetCursorSecret(secret []byte) {
+	r.cursorSecret = secret
+}
+
+// Cursor returns the raw ?cursor= query parameter
+func (tc *Context) Cursor() string {
+	return tc.Query("cursor")
+}
+
+// DecodeCursor decodes the request's ?cursor= parameter into v. It returns
+// false with no error when the request has no cursor (the first page).
+func (tc *Context) DecodeCursor(v any) (bool, error) {
+	cursor := tc.Cursor()
+	if cursor == "" {
+		return false, nil
+	}
+	if tc.router == nil || tc.router.cursorSecret == nil {
+		return false, errNoCursorSecret
+	}
+	return true, DecodeCursor(tc.router.cursorSecret, cursor, v)
+}
+
+// SetNextCursor encodes v as the cursor for the next page and adds a
+// Link: <...>; rel="next" header pointing at the current URL with the new
+// cursor. The encoded cursor is returned so it can also go in the body.
+func (tc *Context) SetNextCursor(v any) (string, error) {
+	if tc.router == nil || tc.router.cursorSecret == nil {
+		return "", errNoCursorSecret
+	}
+
+	cursor, err := EncodeCursor(tc.router.cursorSecret, v)
+	if err != nil {
+		return "", err
+	}
+
+	next := *tc.R.URL
+	query := next.Query()
+	query.Set("cursor", cursor)
+	next.RawQuery = query.Encode()
+
+	tc.W.Header().Add("Link", "<"+next.RequestURI()+`>; rel="next"`)
+	return cursor, nil
+}
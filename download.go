@@ -0,0 +1,140 @@
+package microweb
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// streamProgressInterval is how many bytes StreamFile writes between
+// progress callbacks
+const streamProgressInterval = 1 << 20
+
+// StreamFile streams r to the client as a download named filename without
+// buffering it. The response is flushed after every chunk and onProgress,
+// when not nil, is called with the total bytes written about once per MiB
+// and when the stream ends. Streaming stops with the context's error when
+// the client disconnects.
+func (tc *Context) StreamFile(r io.Reader, filename string, onProgress func(written int64)) error {
+	h := tc.W.Header()
+	if h.Get("Content-Type") == "" {
+		ct := mime.TypeByExtension(filepath.Ext(filename))
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+		h.Set("Content-Type", ct)
+	}
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	tc.W.WriteHeader(http.StatusOK)
+
+	done := tc.Context().Done()
+	buf := make([]byte, 32*1024)
+	var written, reported int64
+
+	for {
+		select {
+		case <-done:
+			return tc.Context().Err()
+		default:
+		}
+
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			if _, err := tc.W.Write(buf[:n]); err != nil {
+				return err
+			}
+			written += int64(n)
+			tc.Flush()
+
+			if onProgress != nil && written-reported >= streamProgressInterval {
+				onProgress(written)
+				reported = written
+			}
+		}
+
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+
+	if onProgress != nil && written != reported {
+		onProgress(written)
+	}
+	return nil
+}
+
+// ServeContent serves content with http.ServeContent, which handles Range,
+// If-Range and conditional requests. If-Range is compared against the ETag
+// header when one is set on the response before calling, otherwise against
+// modtime; when the validator doesn't match the full content is sent. name
+// sets the Content-Type from its extension unless one is already set, and
+// a zero modtime omits Last-Modified.
+func (tc *Context) ServeContent(name string, modtime time.Time, content io.ReadSeeker) {
+	http.ServeContent(tc.W, tc.R, name, modtime, content)
+}
+
+// File serves the file at path with http.ServeFile, which sets the content
+// type and handles Range and conditional requests. When path does not exist
+// or is a directory the router's not-found handler responds and the error
+// is returned.
+func (tc *Context) File(path string) error {
+	return tc.serveFile(path, "")
+}
+
+// Download serves the file at path like File, as an attachment named
+// filename. The base name of path is used when filename is empty.
+func (tc *Context) Download(path, filename string) error {
+	if filename == "" {
+		filename = filepath.Base(path)
+	}
+	return tc.serveFile(path, filename)
+}
+
+// serveFile serves path, as an attachment when filename is set
+func (tc *Context) serveFile(path, filename string) error {
+	info, err := os.Stat(path)
+	if err == nil && info.IsDir() {
+		err = &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			tc.notFound()
+		} else {
+			http.Error(tc.W, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return err
+	}
+
+	if filename != "" {
+		tc.W.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	}
+	http.ServeFile(tc.W, tc.R, path)
+	return nil
+}
+
+// notFound responds with the not-found handler of the route's group or the
+// router, or a plain 404
+func (tc *Context) notFound() {
+	handler := tc.group.notFoundHandlerFor()
+	if handler == nil && tc.router != nil {
+		handler = tc.router.notFoundHandler
+	}
+	if handler == nil {
+		http.NotFound(tc.W, tc.R)
+		return
+	}
+
+	// Keep ServeHTTP from running the not-found handler again
+	if crw, ok := tc.rw.(*customResponseWriter); ok {
+		crw.handled = true
+	}
+	handler(tc)
+}
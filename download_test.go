@@ -0,0 +1,121 @@
+package microweb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileMissingRunsNotFoundHandlerOnce(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.txt")
+
+	r := New()
+	calls := 0
+	r.SetNotFoundHandler(func(c *Context) {
+		calls++
+		c.Status(http.StatusNotFound)
+		c.W.Write([]byte("custom404\n"))
+	})
+	r.Get("/file", func(c *Context) { c.File(missing) })
+	r.Get("/download", func(c *Context) { c.Download(missing, "report.txt") })
+
+	for _, path := range []string{"/file", "/download"} {
+		calls = 0
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if calls != 1 {
+			t.Errorf("%s: not-found handler ran %d times, want 1", path, calls)
+		}
+		if w.Code != http.StatusNotFound || w.Body.String() != "custom404\n" {
+			t.Errorf("%s: got %d %q", path, w.Code, w.Body.String())
+		}
+		if cd := w.Header().Get("Content-Disposition"); cd != "" {
+			t.Errorf("%s: Content-Disposition = %q on a 404", path, cd)
+		}
+	}
+}
+
+func TestServeContentIfRange(t *testing.T) {
+	content := strings.Repeat("0123456789", 500)
+	modtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	newRouter := func(etag string, middlewares ...MiddleWare) *Router {
+		r := New()
+		r.Use(middlewares...)
+		r.Get("/report.txt", func(c *Context) {
+			if etag != "" {
+				c.W.Header().Set("ETag", etag)
+			}
+			c.ServeContent("report.txt", modtime, strings.NewReader(content))
+		})
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		etag    string
+		ifRange string
+		status  int
+	}{
+		{"etag match", `"v1"`, `"v1"`, http.StatusPartialContent},
+		{"etag mismatch", `"v1"`, `"v2"`, http.StatusOK},
+		{"date match", "", modtime.Format(http.TimeFormat), http.StatusPartialContent},
+		{"date mismatch", "", modtime.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/report.txt", nil)
+			req.Header.Set("Range", "bytes=0-9")
+			req.Header.Set("If-Range", tt.ifRange)
+			w := httptest.NewRecorder()
+			newRouter(tt.etag).ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			want := content
+			if tt.status == http.StatusPartialContent {
+				want = content[:10]
+			}
+			if w.Body.String() != want {
+				t.Errorf("body has %d bytes, want %d", w.Body.Len(), len(want))
+			}
+		})
+	}
+
+	t.Run("partial content is not gzipped", func(t *testing.T) {
+		r := newRouter(`"v1"`, Gzip())
+
+		req := httptest.NewRequest(http.MethodGet, "/report.txt", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		req.Header.Set("Range", "bytes=0-9")
+		req.Header.Set("If-Range", `"v1"`)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusPartialContent {
+			t.Fatalf("status = %d, want 206", w.Code)
+		}
+		if ce := w.Header().Get("Content-Encoding"); ce != "" {
+			t.Errorf("Content-Encoding = %q on a 206", ce)
+		}
+		if w.Body.String() != content[:10] {
+			t.Errorf("body = %q, want %q", w.Body.String(), content[:10])
+		}
+
+		// The full response is still compressed
+		req = httptest.NewRequest(http.MethodGet, "/report.txt", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if ce := w.Header().Get("Content-Encoding"); w.Code != http.StatusOK || ce != "gzip" {
+			t.Errorf("full response: status %d, Content-Encoding %q, want 200 gzip", w.Code, ce)
+		}
+	})
+}
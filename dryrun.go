@@ -0,0 +1,80 @@
+package microweb
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// DryRun returns the names of the middlewares and handler that would run,
+// in order, for a request with the given method and path, without running
+// them. Names come from the functions' symbols, so closures returned by
+// constructors are reported as e.g. "microweb.GzipWith.func1".
+// Middleware attached with UseOnly is part of the handler and not listed.
+// DryRun returns nil when no route matches.
+func (mw *Router) DryRun(method, path string) []string {
+	req, err := http.NewRequest(method, path, nil)
+	if err != nil {
+		return nil
+	}
+	_, pattern := mw.mux.Handler(req)
+	if pattern == "" {
+		return nil
+	}
+
+	var route *Route
+	for _, rt := range mw.table {
+		if rt.Method+" "+rt.Path == pattern {
+			route = rt
+			break
+		}
+	}
+	if route == nil {
+		return nil
+	}
+
+	var names []string
+	for _, m := range mw.premiddleware {
+		names = append(names, funcName(m))
+	}
+	if route.group != nil {
+		names = append(names, groupMiddlewareNames(route.group)...)
+	}
+	names = append(names, funcName(route.handler))
+	for _, m := range mw.postmiddleware {
+		names = append(names, funcName(m))
+	}
+	return names
+}
+
+// groupMiddlewareNames lists the middleware of g and its parents, outermost
+// group first
+func groupMiddlewareNames(g *Group) []string {
+	var names []string
+	if g.parent != nil {
+		names = groupMiddlewareNames(g.parent)
+	}
+	for _, m := range g.middleware {
+		names = append(names, funcName(m))
+	}
+	return names
+}
+
+// funcName returns the package-qualified name of a function
+func funcName(fn any) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return "<nil>"
+	}
+
+	f := runtime.FuncForPC(v.Pointer())
+	if f == nil {
+		return "<unknown>"
+	}
+	name := f.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
@@ -0,0 +1,140 @@
+package microweb
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DumpRoute writes a transcript of every request to the route registered for
+// method and path, with its response, to w. The request body is read and
+// restored, and the response passes through unchanged while it is copied, so
+// handlers behave as normal. Calling DumpRoute again with a nil writer stops
+// dumping. It is meant for temporary debugging: bodies are held in memory
+// and headers such as Authorization are written as-is.
+func (mw *Router) DumpRoute(method, path string, w io.Writer) {
+	path, _ = parseConstraints(path)
+	key := method + " " + path
+
+	if w == nil {
+		mw.dumps.Delete(key)
+		return
+	}
+	mw.dumps.Store(key, &dumpTarget{w: w})
+}
+
+// dumpTarget serializes transcripts written to a dump writer
+type dumpTarget struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// startDump captures the request and tees the response when the matched
+// route is being dumped
+func (mw *Router) startDump(c *Context) {
+	if c.R.Pattern == "" {
+		return
+	}
+	v, ok := mw.dumps.Load(c.R.Pattern)
+	if !ok {
+		return
+	}
+	target := v.(*dumpTarget)
+
+	request, err := httputil.DumpRequest(c.R, true)
+	if err != nil {
+		request = []byte(fmt.Sprintf("(request dump failed: %v)\n", err))
+	}
+
+	dw := &dumpWriter{ResponseWriter: c.W, status: http.StatusOK}
+	c.W = dw
+	start := time.Now()
+
+	c.OnComplete(func(c *Context) {
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "=== %s %s %s (%s)\n", start.Format(time.RFC3339), c.R.Method, c.R.URL.RequestURI(), time.Since(start))
+		buf.WriteString("--- request\n")
+		buf.Write(bytes.ReplaceAll(request, []byte("\r\n"), []byte("\n")))
+		buf.WriteString("\n--- response\n")
+		fmt.Fprintf(&buf, "%s %d %s\n", c.R.Proto, dw.status, http.StatusText(dw.status))
+
+		header := dw.Header()
+		keys := make([]string, 0, len(header))
+		for k := range header {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			for _, v := range header[k] {
+				fmt.Fprintf(&buf, "%s: %s\n", k, v)
+			}
+		}
+		buf.WriteString("\n")
+		buf.Write(dw.body.Bytes())
+		buf.WriteString("\n\n")
+
+		target.mu.Lock()
+		target.w.Write(buf.Bytes())
+		target.mu.Unlock()
+	})
+}
+
+// dumpWriter passes a response through while keeping a copy of it
+type dumpWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (dw *dumpWriter) WriteHeader(code int) {
+	if !dw.wroteHeader {
+		dw.status = code
+		dw.wroteHeader = code >= 200 || code == http.StatusSwitchingProtocols
+	}
+	dw.ResponseWriter.WriteHeader(code)
+}
+
+func (dw *dumpWriter) Write(b []byte) (int, error) {
+	dw.wroteHeader = true
+	n, err := dw.ResponseWriter.Write(b)
+	dw.body.Write(b[:n])
+	return n, err
+}
+
+func (dw *dumpWriter) Flush() {
+	if http.NewResponseController(dw.ResponseWriter).Flush() == nil {
+		dw.wroteHeader = true
+	}
+}
+
+// Hijack passes through to the underlying writer so WebSocket routes can be
+// dumped. The transcript shows a 101 with whatever was written before.
+func (dw *dumpWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(dw.ResponseWriter).Hijack()
+	if err == nil {
+		dw.status = http.StatusSwitchingProtocols
+		dw.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+func (dw *dumpWriter) Status() int {
+	return dw.status
+}
+
+func (dw *dumpWriter) Written() bool {
+	return dw.wroteHeader
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (dw *dumpWriter) Unwrap() http.ResponseWriter {
+	return dw.ResponseWriter
+}
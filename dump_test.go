@@ -0,0 +1,72 @@
+package microweb
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// syncBuffer is a bytes.Buffer safe to read while a server writes to it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestDumpRouteKeepsWriterFeatures checks that dumping a route doesn't hide
+// Flusher or Hijacker from its handler
+func TestDumpRouteKeepsWriterFeatures(t *testing.T) {
+	hub := NewWsHub(DefaultWsConfig())
+	go hub.Run()
+
+	r := New()
+	r.Get("/flush", func(c *Context) {
+		c.String("part")
+		if err := http.NewResponseController(c.W).Flush(); err != nil {
+			c.String(" " + err.Error())
+		}
+	})
+	r.Get("/ws", func(c *Context) {
+		serveWs(hub, c, nil, func(*ClientContext) WsData { return nil }, nil)
+	})
+
+	var out syncBuffer
+	r.DumpRoute(http.MethodGet, "/flush", &out)
+	r.DumpRoute(http.MethodGet, "/ws", &out)
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/flush")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+srv.URL[len("http"):]+"/ws", nil)
+	if err != nil {
+		t.Fatalf("WebSocket upgrade on a dumped route: %v", err)
+	}
+	conn.Close()
+
+	waitFor(t, func() bool { return strings.Count(out.String(), "=== ") == 2 })
+	if dump := out.String(); strings.Contains(dump, "not supported") || !strings.Contains(dump, "101") {
+		t.Fatalf("transcript:\n%s", dump)
+	}
+}
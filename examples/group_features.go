@@ -184,11 +184,7 @@ func main() {
 	special := router.Group("/special")
 
 	// This middleware only applies to the specific handler, not the whole group
-	rateLimitMiddleware := func(ctx *microweb.Context) bool {
-		// Simple rate limiting check
-		log.Println("Rate limit check for:", ctx.R.URL.Path)
-		return true
-	}
+	rateLimitMiddleware := microweb.RateLimit(5, 10)
 
 	special.Get("/limited", special.UseOnly(
 		func(ctx *microweb.Context) {
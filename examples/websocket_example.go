@@ -58,8 +58,9 @@ func main() {
 	// ====================================
 	// WebSocket Route
 	// ====================================
-	router.Ws("/ws", func(ctx *microweb.ClientContext) *microweb.WsData {
-		// Connection lifecycle hooks
+	// Connection lifecycle hooks are registered once per connection in the
+	// setup function; the message handler below runs for every message
+	setup := func(ctx *microweb.ClientContext) {
 		ctx.On("open", func(c *microweb.ClientContext) {
 			log.Printf("Client connected: %s", c.Id)
 
@@ -78,7 +79,9 @@ func main() {
 		ctx.On("error", func(c *microweb.ClientContext) {
 			log.Printf("Client error: %s - %v", c.Id, c.Data.Get("error"))
 		})
+	}
 
+	router.WsWithSetup("/ws", setup, func(ctx *microweb.ClientContext) microweb.WsData {
 		// Handle incoming messages
 		cmd := ctx.Data.String("cmd")
 
@@ -102,7 +105,7 @@ func main() {
 		case "broadcast":
 			// Broadcast to all other clients
 			message := ctx.Data.String("message")
-			microweb.Hub.Broadcast(map[string]interface{}{
+			ctx.BroadcastExceptSelf(map[string]interface{}{
 				"type":    "broadcast",
 				"from":    ctx.Id,
 				"message": message,
@@ -0,0 +1,25 @@
+package microweb
+
+// FlagProvider evaluates feature flags per request so flags can depend on
+// the caller (user, tenant, headers, ...)
+type FlagProvider interface {
+	Enabled(ctx *Context, flag string) bool
+}
+
+// SetFlagProvider sets the provider consulted by GetFlagged
+func (r *Router) SetFlagProvider(provider FlagProvider) {
+	r.flagProvider = provider
+}
+
+// GetFlagged registers a GET handler that dispatches to onHandler when flag
+// is enabled for the request and to offHandler otherwise. Without a flag
+// provider every flag is off.
+func (mw *Router) GetFlagged(path string, flag string, onHandler, offHandler Handler) *Route {
+	return mw.Get(path, func(ctx *Context) {
+		if mw.flagProvider != nil && mw.flagProvider.Enabled(ctx, flag) {
+			onHandler(ctx)
+			return
+		}
+		offHandler(ctx)
+	})
+}
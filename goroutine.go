@@ -0,0 +1,47 @@
+package microweb
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+var goPanicHandler atomic.Value // func(err any)
+
+// SetGoPanicHandler sets the handler for panics recovered by Go and GoCtx.
+// Without one, panics are logged with their stack trace.
+func SetGoPanicHandler(handler func(err any)) {
+	goPanicHandler.Store(handler)
+}
+
+// Go runs fn in a new goroutine, recovering any panic so background work
+// started by handlers cannot crash the process
+func Go(fn func()) {
+	go func() {
+		defer recoverGo()
+		fn()
+	}()
+}
+
+// GoCtx runs fn in a new goroutine with ctx, recovering any panic
+func GoCtx(ctx context.Context, fn func(context.Context)) {
+	go func() {
+		defer recoverGo()
+		fn(ctx)
+	}()
+}
+
+// recoverGo routes a recovered panic to the global panic handler
+func recoverGo() {
+	err := recover()
+	if err == nil {
+		return
+	}
+
+	if handler, ok := goPanicHandler.Load().(func(err any)); ok && handler != nil {
+		handler(err)
+		return
+	}
+	log.Printf("PANIC in goroutine: %v\n%s", err, debug.Stack())
+}
@@ -3,6 +3,8 @@ package microweb
 import (
 	"net/http"
 	"path/filepath"
+	"slices"
+	"strings"
 )
 
 type Group struct {
@@ -12,9 +14,15 @@ type Group struct {
 	parent     *Group
 	children   []*Group
 	routes     []string // track registered routes
+	cors       MiddleWare
+
+	panicHandler    PanicHandler
+	notFoundHandler Handler
 }
 
-func (g *Group) Group(prefix string) *Group {
+// Group creates a child group. Any fns are called with the new group to
+// register its routes.
+func (g *Group) Group(prefix string, fns ...func(*Group)) *Group {
 	child := &Group{
 		r:          g.r,
 		parent:     g,
@@ -24,6 +32,10 @@ func (g *Group) Group(prefix string) *Group {
 		routes:     []string{},
 	}
 	g.children = append(g.children, child)
+
+	for _, fn := range fns {
+		fn(child)
+	}
 	return child
 }
 
@@ -36,17 +48,12 @@ func (g *Group) runMiddlewares(ctx *Context) bool {
 	}
 
 	// Then run this group's middlewares
-	for _, m := range g.middleware {
-		if !m(ctx) {
-			return false
-		}
-	}
-
-	return true
+	return runChain(ctx, g.middleware)
 }
 
 func (g *Group) middle(h Handler) Handler {
 	return func(ctx *Context) {
+		ctx.group = g
 		if !g.runMiddlewares(ctx) {
 			return
 		}
@@ -55,6 +62,63 @@ func (g *Group) middle(h Handler) Handler {
 	}
 }
 
+// SetPanicHandler overrides the router's panic handler for routes in the
+// group and its child groups, unless a child sets its own
+func (g *Group) SetPanicHandler(handler PanicHandler) {
+	g.panicHandler = handler
+}
+
+// SetNotFoundHandler overrides the router's not-found handler for paths
+// under the group's prefix, unless a child group sets its own
+func (g *Group) SetNotFoundHandler(handler Handler) {
+	g.notFoundHandler = handler
+}
+
+// panicHandlerFor returns the panic handler of the nearest group in the
+// chain that has one, or nil
+func (g *Group) panicHandlerFor() PanicHandler {
+	for ; g != nil; g = g.parent {
+		if g.panicHandler != nil {
+			return g.panicHandler
+		}
+	}
+	return nil
+}
+
+// notFoundHandlerFor returns the not-found handler of the nearest group in
+// the chain that has one, or nil
+func (g *Group) notFoundHandlerFor() Handler {
+	for ; g != nil; g = g.parent {
+		if g.notFoundHandler != nil {
+			return g.notFoundHandler
+		}
+	}
+	return nil
+}
+
+// owns reports whether path is the group's prefix or below it
+func (g *Group) owns(path string) bool {
+	prefix := strings.TrimSuffix(g.prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// groupFor returns the group with the longest prefix owning path, or nil
+func groupFor(groups []*Group, path string) *Group {
+	var best *Group
+	for _, g := range groups {
+		if !g.owns(path) {
+			continue
+		}
+		if child := groupFor(g.children, path); child != nil {
+			g = child
+		}
+		if best == nil || len(g.prefix) > len(best.prefix) {
+			best = g
+		}
+	}
+	return best
+}
+
 func (g *Group) Use(middlewares ...MiddleWare) {
 	g.middleware = append(g.middleware, middlewares...)
 }
@@ -62,65 +126,93 @@ func (g *Group) Use(middlewares ...MiddleWare) {
 // UseOnly applies middleware to a specific handler without adding to group
 func (g *Group) UseOnly(handler Handler, middlewares ...MiddleWare) Handler {
 	return func(ctx *Context) {
-		for _, m := range middlewares {
-			if !m(ctx) {
-				return
-			}
+		if runChain(ctx, middlewares) {
+			handler(ctx)
 		}
-		handler(ctx)
 	}
 }
 
-func (g *Group) Get(path string, handler Handler) {
+func (g *Group) Get(path string, handler Handler) *Route {
 	fullPath := filepath.Join(g.prefix, path)
 	g.routes = append(g.routes, "GET "+fullPath)
-	g.r.Get(fullPath, g.middle(handler))
+	return g.track(g.r.Get(fullPath, g.middle(handler)), handler)
 }
 
-func (g *Group) Post(path string, handler Handler) {
+func (g *Group) Post(path string, handler Handler) *Route {
 	fullPath := filepath.Join(g.prefix, path)
 	g.routes = append(g.routes, "POST "+fullPath)
-	g.r.Post(fullPath, g.middle(handler))
+	return g.track(g.r.Post(fullPath, g.middle(handler)), handler)
 }
 
-func (g *Group) Put(path string, handler Handler) {
+func (g *Group) Put(path string, handler Handler) *Route {
 	fullPath := filepath.Join(g.prefix, path)
 	g.routes = append(g.routes, "PUT "+fullPath)
-	g.r.Put(fullPath, g.middle(handler))
+	return g.track(g.r.Put(fullPath, g.middle(handler)), handler)
 }
 
-func (g *Group) Delete(path string, handler Handler) {
+func (g *Group) Delete(path string, handler Handler) *Route {
 	fullPath := filepath.Join(g.prefix, path)
 	g.routes = append(g.routes, "DELETE "+fullPath)
-	g.r.Delete(fullPath, g.middle(handler))
+	return g.track(g.r.Delete(fullPath, g.middle(handler)), handler)
 }
 
-func (g *Group) Patch(path string, handler Handler) {
+func (g *Group) Patch(path string, handler Handler) *Route {
 	fullPath := filepath.Join(g.prefix, path)
 	g.routes = append(g.routes, "PATCH "+fullPath)
-	g.r.Patch(fullPath, g.middle(handler))
+	return g.track(g.r.Patch(fullPath, g.middle(handler)), handler)
 }
 
-func (g *Group) Options(path string, handler Handler) {
+func (g *Group) Options(path string, handler Handler) *Route {
 	fullPath := filepath.Join(g.prefix, path)
 	g.routes = append(g.routes, "OPTIONS "+fullPath)
-	g.r.Options(fullPath, g.middle(handler))
+	return g.track(g.r.Options(fullPath, g.middle(handler)), handler)
 }
 
-func (g *Group) Head(path string, handler Handler) {
+func (g *Group) Head(path string, handler Handler) *Route {
 	fullPath := filepath.Join(g.prefix, path)
 	g.routes = append(g.routes, "HEAD "+fullPath)
-	g.r.Head(fullPath, g.middle(handler))
+	return g.track(g.r.Head(fullPath, g.middle(handler)), handler)
+}
+
+// GetOptional is Router.GetOptional for the group
+func (g *Group) GetOptional(path string, handler Handler) *Route {
+	var rt *Route
+	for _, p := range expandOptional(path) {
+		rt = g.Get(p, handler)
+	}
+	return rt
+}
+
+// track records g as the group a route was registered through, along with
+// the handler before group middleware was applied, and registers a preflight
+// route when the group has CORS
+func (g *Group) track(rt *Route, handler Handler) *Route {
+	rt.group = g
+	rt.handler = handler
+	if cors := g.corsMiddleware(); cors != nil {
+		g.r.preflight(rt.Path, cors)
+	}
+	return rt
+}
+
+// middlewareCount returns the number of middlewares in the group chain
+func (g *Group) middlewareCount() int {
+	n := len(g.middleware)
+	if g.parent != nil {
+		n += g.parent.middlewareCount()
+	}
+	return n
 }
 
 // Any registers a handler for all HTTP methods
 func (g *Group) Any(path string, handler Handler) {
+	// OPTIONS goes first so a CORS group doesn't add its own preflight route
+	g.Options(path, handler)
 	g.Get(path, handler)
 	g.Post(path, handler)
 	g.Put(path, handler)
 	g.Delete(path, handler)
 	g.Patch(path, handler)
-	g.Options(path, handler)
 	g.Head(path, handler)
 }
 
@@ -129,23 +221,28 @@ func (g *Group) Match(methods []string, path string, handler Handler) {
 	fullPath := filepath.Join(g.prefix, path)
 	wrappedHandler := g.middle(handler)
 
+	// OPTIONS goes first so a CORS group doesn't add its own preflight route
+	if i := slices.Index(methods, http.MethodOptions); i > 0 {
+		methods = append([]string{http.MethodOptions}, slices.Delete(slices.Clone(methods), i, i+1)...)
+	}
+
 	for _, method := range methods {
 		g.routes = append(g.routes, method+" "+fullPath)
 		switch method {
 		case http.MethodGet:
-			g.r.Get(fullPath, wrappedHandler)
+			g.track(g.r.Get(fullPath, wrappedHandler), handler)
 		case http.MethodPost:
-			g.r.Post(fullPath, wrappedHandler)
+			g.track(g.r.Post(fullPath, wrappedHandler), handler)
 		case http.MethodPut:
-			g.r.Put(fullPath, wrappedHandler)
+			g.track(g.r.Put(fullPath, wrappedHandler), handler)
 		case http.MethodDelete:
-			g.r.Delete(fullPath, wrappedHandler)
+			g.track(g.r.Delete(fullPath, wrappedHandler), handler)
 		case http.MethodPatch:
-			g.r.Patch(fullPath, wrappedHandler)
+			g.track(g.r.Patch(fullPath, wrappedHandler), handler)
 		case http.MethodOptions:
-			g.r.Options(fullPath, wrappedHandler)
+			g.track(g.r.Options(fullPath, wrappedHandler), handler)
 		case http.MethodHead:
-			g.r.Head(fullPath, wrappedHandler)
+			g.track(g.r.Head(fullPath, wrappedHandler), handler)
 		}
 	}
 }
@@ -155,8 +252,13 @@ func (g *Group) Static(path string) {
 	g.r.StaticWithPrefix(g.prefix, path)
 }
 
-// Routes returns all routes registered in this group (not including children)
-func (g *Group) Routes() []string {
+// Routes returns all routes registered in this group (not including children).
+// Any fns are first called with the group, so its routes can be registered
+// in one block: router.Group("/api").Routes(func(g *Group) { g.Get(...) })
+func (g *Group) Routes(fns ...func(*Group)) []string {
+	for _, fn := range fns {
+		fn(g)
+	}
 	return g.routes
 }
 
@@ -0,0 +1,281 @@
+package microweb
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gzipPools holds reusable writers for each compression level, indexed by
+// level - gzip.HuffmanOnly
+var gzipPools [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+
+// NoCompressKey is the context key handlers set to true, with
+// ctx.Set(NoCompressKey, true), to skip compression of their response
+const NoCompressKey = "no-compress"
+
+// GzipOptions configures the Gzip middleware
+type GzipOptions struct {
+	// Level is the gzip compression level. Invalid levels fall back to
+	// gzip.DefaultCompression.
+	Level int
+
+	// MinSize is the smallest body in bytes that is compressed. Smaller
+	// responses are sent as-is. Flushing a response compresses it
+	// regardless of size.
+	MinSize int
+}
+
+// DefaultGzipOptions returns default gzip options
+func DefaultGzipOptions() *GzipOptions {
+	return &GzipOptions{
+		Level:   gzip.DefaultCompression,
+		MinSize: 512,
+	}
+}
+
+// Gzip compresses responses for clients that accept gzip, using the default
+// options
+func Gzip() MiddleWare {
+	return GzipWith(nil)
+}
+
+// GzipLevel compresses responses for clients that accept gzip at the given
+// level, using the default options otherwise
+func GzipLevel(level int) MiddleWare {
+	options := DefaultGzipOptions()
+	options.Level = level
+	return GzipWith(options)
+}
+
+// GzipWith compresses responses for clients that accept gzip. Responses that
+// already carry a Content-Encoding, have no body (204, 304), are partial
+// content (206), are smaller than MinSize, have an already-compressed content
+// type such as images, video, audio and archives, or whose handler set
+// NoCompressKey are passed through. WebSocket upgrades are never wrapped.
+func GzipWith(options *GzipOptions) MiddleWare {
+	if options == nil {
+		options = DefaultGzipOptions()
+	}
+	level := options.Level
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
+	}
+	minSize := max(options.MinSize, 0)
+
+	return func(c *Context) bool {
+		if c.R.Header.Get("Upgrade") == "websocket" || !acceptsGzip(c.R.Header.Get("Accept-Encoding")) {
+			return true
+		}
+
+		gw := &gzipWriter{ResponseWriter: c.W, ctx: c, level: level, minSize: minSize, code: http.StatusOK}
+		c.W = gw
+		c.W.Header().Add("Vary", "Accept-Encoding")
+
+		c.OnComplete(func(c *Context) {
+			gw.Close()
+		})
+		return true
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.TrimSpace(coding)
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(q, 64); err == nil && f == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// incompressible reports whether a content type is already compressed
+func incompressible(contentType string) bool {
+	ct, _, _ := strings.Cut(contentType, ";")
+	ct = strings.TrimSpace(strings.ToLower(ct))
+
+	switch {
+	case ct == "image/svg+xml":
+		return false
+	case strings.HasPrefix(ct, "image/"),
+		strings.HasPrefix(ct, "video/"),
+		strings.HasPrefix(ct, "audio/"),
+		strings.HasPrefix(ct, "font/woff"):
+		return true
+	}
+
+	switch ct {
+	case "application/zip", "application/gzip", "application/x-gzip",
+		"application/zstd", "application/x-bzip2", "application/x-xz",
+		"application/x-7z-compressed", "application/x-rar-compressed",
+		"application/pdf", "application/wasm":
+		return true
+	}
+	return false
+}
+
+// gzipWriter compresses the response body. The status is held back and the
+// body buffered until MinSize bytes are written, the response is flushed or
+// the handler chain completes, so handlers can still opt out or set headers
+// before anything is sent.
+type gzipWriter struct {
+	http.ResponseWriter
+	ctx         *Context
+	level       int
+	minSize     int
+	gz          *gzip.Writer
+	buf         []byte
+	code        int
+	wroteHeader bool // the handler wrote a status or body
+	started     bool // the status was sent to the underlying writer
+}
+
+func (gw *gzipWriter) WriteHeader(code int) {
+	if gw.wroteHeader {
+		return
+	}
+	gw.wroteHeader = true
+	gw.code = code
+
+	if !gw.eligible() {
+		gw.start(false)
+		return
+	}
+	if n, err := strconv.Atoi(gw.Header().Get("Content-Length")); err == nil && n < gw.minSize {
+		gw.start(false)
+	}
+}
+
+func (gw *gzipWriter) Write(b []byte) (int, error) {
+	if !gw.wroteHeader {
+		// Sniff from the uncompressed bytes; the server would otherwise
+		// sniff the compressed output
+		if gw.Header().Get("Content-Type") == "" {
+			gw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		gw.WriteHeader(http.StatusOK)
+	}
+
+	if gw.started {
+		if gw.gz == nil {
+			return gw.ResponseWriter.Write(b)
+		}
+		return gw.gz.Write(b)
+	}
+
+	gw.buf = append(gw.buf, b...)
+	if len(gw.buf) >= gw.minSize {
+		gw.start(true)
+		if err := gw.flushBuf(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// eligible reports whether the response may be compressed
+func (gw *gzipWriter) eligible() bool {
+	h := gw.Header()
+	return gw.code >= 200 && gw.code != http.StatusNoContent && gw.code != http.StatusNotModified &&
+		gw.code != http.StatusPartialContent && h.Get("Content-Range") == "" &&
+		h.Get("Content-Encoding") == "" && !incompressible(h.Get("Content-Type")) &&
+		gw.ctx.Get(NoCompressKey) != true
+}
+
+// start sends the status to the underlying writer, compressing the body
+// when compress is set and the response is eligible
+func (gw *gzipWriter) start(compress bool) {
+	if gw.started {
+		return
+	}
+	gw.started = true
+
+	if compress && gw.eligible() {
+		h := gw.Header()
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", "gzip")
+		gw.gz = newGzipWriter(gw.ResponseWriter, gw.level)
+	}
+	gw.ResponseWriter.WriteHeader(gw.code)
+}
+
+// flushBuf writes the buffered body
+func (gw *gzipWriter) flushBuf() error {
+	if len(gw.buf) == 0 {
+		return nil
+	}
+	buf := gw.buf
+	gw.buf = nil
+
+	var err error
+	if gw.gz == nil {
+		_, err = gw.ResponseWriter.Write(buf)
+	} else {
+		_, err = gw.gz.Write(buf)
+	}
+	return err
+}
+
+func (gw *gzipWriter) Flush() {
+	if gw.wroteHeader && !gw.started {
+		gw.start(true)
+		gw.flushBuf()
+	}
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+	if f, ok := gw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (gw *gzipWriter) Status() int {
+	if gw.wroteHeader && !gw.started {
+		return gw.code
+	}
+	if sr, ok := gw.ResponseWriter.(statusReporter); ok {
+		return sr.Status()
+	}
+	return http.StatusOK
+}
+
+func (gw *gzipWriter) Written() bool {
+	return gw.wroteHeader
+}
+
+// Close sends any buffered response, finishes the gzip stream and returns
+// the writer to its pool
+func (gw *gzipWriter) Close() {
+	if gw.wroteHeader && !gw.started {
+		gw.start(false)
+		gw.flushBuf()
+	}
+
+	if gw.gz == nil {
+		return
+	}
+	gw.gz.Close()
+	gzipPools[gw.level-gzip.HuffmanOnly].Put(gw.gz)
+	gw.gz = nil
+}
+
+// newGzipWriter takes a writer for level from the pool, or creates one
+func newGzipWriter(w http.ResponseWriter, level int) *gzip.Writer {
+	if gz, ok := gzipPools[level-gzip.HuffmanOnly].Get().(*gzip.Writer); ok {
+		gz.Reset(w)
+		return gz
+	}
+	gz, _ := gzip.NewWriterLevel(w, level)
+	return gz
+}
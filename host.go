@@ -0,0 +1,56 @@
+package microweb
+
+import (
+	"net/http"
+)
+
+// RequireHost rejects requests that arrive without a Host header with 400.
+// net/http already rejects HTTP/1.1 requests without Host; this also covers
+// HTTP/1.0 clients. A default host set with SetDefaultHost takes precedence.
+func (mw *Router) RequireHost() {
+	mw.requireHost = true
+}
+
+// SetDefaultHost sets the Host used for requests that arrive without one,
+// such as HTTP/1.0 requests
+func (mw *Router) SetDefaultHost(host string) {
+	mw.defaultHost = host
+}
+
+// checkHost applies the Host options to r, reporting false when the request
+// was rejected
+func (mw *Router) checkHost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Host != "" {
+		return true
+	}
+
+	if mw.defaultHost != "" {
+		r.Host = mw.defaultHost
+		return true
+	}
+
+	if mw.requireHost {
+		http.Error(w, "Missing Host header", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// FullURL returns the absolute URL of the request. Requests without a Host
+// (possible over HTTP/1.0 unless SetDefaultHost or RequireHost is used) get
+// just the request URI.
+func (tc *Context) FullURL() string {
+	host := tc.R.Host
+	if host == "" {
+		host = tc.R.URL.Host
+	}
+	if host == "" {
+		return tc.R.URL.RequestURI()
+	}
+
+	scheme := "http"
+	if tc.IsSecure() {
+		scheme = "https"
+	}
+	return scheme + "://" + host + tc.R.URL.RequestURI()
+}
@@ -0,0 +1,108 @@
+package microweb
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// rawRequest sends a raw request to srv and returns the status and body
+func rawRequest(t *testing.T, srv *httptest.Server, request string) (int, string) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, request); err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	return res.StatusCode, string(body)
+}
+
+func newHostServer(configure func(*Router)) *httptest.Server {
+	r := New()
+	configure(r)
+	r.Get("/url", func(c *Context) {
+		c.String(c.FullURL())
+	})
+	return httptest.NewServer(r)
+}
+
+func TestHTTP10WithoutHost(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*Router)
+		status    int
+		body      string
+	}{
+		{"default", func(*Router) {}, http.StatusOK, "/url"},
+		{"RequireHost", func(r *Router) { r.RequireHost() }, http.StatusBadRequest, "Missing Host header\n"},
+		{"SetDefaultHost", func(r *Router) { r.SetDefaultHost("example.com") }, http.StatusOK, "http://example.com/url"},
+		{"both", func(r *Router) {
+			r.RequireHost()
+			r.SetDefaultHost("example.com")
+		}, http.StatusOK, "http://example.com/url"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newHostServer(tt.configure)
+			defer srv.Close()
+
+			status, body := rawRequest(t, srv, "GET /url HTTP/1.0\r\n\r\n")
+			if status != tt.status || body != tt.body {
+				t.Errorf("got %d %q, want %d %q", status, body, tt.status, tt.body)
+			}
+		})
+	}
+}
+
+func TestHTTP10WithHostIsUnchanged(t *testing.T) {
+	srv := newHostServer(func(r *Router) {
+		r.RequireHost()
+		r.SetDefaultHost("example.com")
+	})
+	defer srv.Close()
+
+	status, body := rawRequest(t, srv, "GET /url HTTP/1.0\r\nHost: api.test\r\n\r\n")
+	if status != http.StatusOK || body != "http://api.test/url" {
+		t.Errorf("got %d %q", status, body)
+	}
+}
+
+func TestMalformedRequestLines(t *testing.T) {
+	srv := newHostServer(func(r *Router) { r.RequireHost() })
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		request string
+		status  int
+	}{
+		{"GARBAGE\r\n\r\n", http.StatusBadRequest},
+		{"GET /url\r\n\r\n", http.StatusBadRequest},
+		{"GET /url HTTP/1.1\r\n\r\n", http.StatusBadRequest}, // HTTP/1.1 requires Host
+		{"GET /url HTTP/9.9\r\n\r\n", http.StatusHTTPVersionNotSupported},
+	} {
+		if status, _ := rawRequest(t, srv, tt.request); status != tt.status {
+			t.Errorf("%q: status = %d, want %d", tt.request, status, tt.status)
+		}
+	}
+
+	// The server keeps serving well-formed requests afterwards
+	if status, _ := rawRequest(t, srv, "GET /url HTTP/1.0\r\nHost: api.test\r\n\r\n"); status != http.StatusOK {
+		t.Errorf("status after malformed requests = %d, want 200", status)
+	}
+}
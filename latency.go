@@ -0,0 +1,134 @@
+package microweb
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultLatencySamples is the number of recent samples kept per route when
+// TrackLatency is called with a size of zero
+const DefaultLatencySamples = 1024
+
+// LatencyStats summarizes recent handler latency for a route. Durations are
+// encoded in JSON as nanoseconds.
+type LatencyStats struct {
+	Count int64         `json:"count"`
+	P50   time.Duration `json:"p50"`
+	P95   time.Duration `json:"p95"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+// LatencyTracker keeps a window of the most recent handler latencies per
+// route pattern
+type LatencyTracker struct {
+	mu     sync.RWMutex
+	size   int
+	routes map[string]*latencyWindow
+}
+
+// latencyWindow is a ring buffer of recent samples for one route
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	count   int64
+}
+
+// NewLatencyTracker creates a tracker that keeps size samples per route
+func NewLatencyTracker(size int) *LatencyTracker {
+	if size <= 0 {
+		size = DefaultLatencySamples
+	}
+	return &LatencyTracker{size: size, routes: make(map[string]*latencyWindow)}
+}
+
+// Record adds a latency sample for route
+func (t *LatencyTracker) Record(route string, d time.Duration) {
+	t.mu.RLock()
+	win := t.routes[route]
+	t.mu.RUnlock()
+
+	if win == nil {
+		t.mu.Lock()
+		if win = t.routes[route]; win == nil {
+			win = &latencyWindow{samples: make([]time.Duration, 0, t.size)}
+			t.routes[route] = win
+		}
+		t.mu.Unlock()
+	}
+
+	win.mu.Lock()
+	if len(win.samples) < cap(win.samples) {
+		win.samples = append(win.samples, d)
+	} else {
+		win.samples[win.next] = d
+		win.next = (win.next + 1) % len(win.samples)
+	}
+	win.count++
+	win.mu.Unlock()
+}
+
+// Stats returns percentiles over the recent samples of every route
+func (t *LatencyTracker) Stats() map[string]LatencyStats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	stats := make(map[string]LatencyStats, len(t.routes))
+	for route, win := range t.routes {
+		stats[route] = win.stats()
+	}
+	return stats
+}
+
+func (w *latencyWindow) stats() LatencyStats {
+	w.mu.Lock()
+	sorted := slices.Clone(w.samples)
+	count := w.count
+	w.mu.Unlock()
+
+	slices.Sort(sorted)
+	return LatencyStats{
+		Count: count,
+		P50:   percentile(sorted, 50),
+		P95:   percentile(sorted, 95),
+		P99:   percentile(sorted, 99),
+		Max:   percentile(sorted, 100),
+	}
+}
+
+// percentile returns the p-th percentile of sorted using nearest rank
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// TrackLatency enables per-route latency tracking, keeping the most recent
+// samples for each route pattern. Unmatched requests and WebSocket upgrades
+// are not tracked.
+func (mw *Router) TrackLatency(samples int) {
+	mw.latency = NewLatencyTracker(samples)
+}
+
+// Latencies returns latency percentiles keyed by route pattern, or nil when
+// tracking is not enabled
+func (mw *Router) Latencies() map[string]LatencyStats {
+	if mw.latency == nil {
+		return nil
+	}
+	return mw.latency.Stats()
+}
+
+// LatencyHandler serves the output of Latencies as JSON
+func (mw *Router) LatencyHandler() Handler {
+	return func(c *Context) {
+		c.Json(mw.Latencies())
+	}
+}
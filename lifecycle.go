@@ -0,0 +1,83 @@
+package microweb
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// OnStart registers a hook run, in registration order, before the server
+// starts listening. If a hook fails the remaining hooks are skipped and the
+// Listen, Serve or Start call returns the error without serving.
+func (r *Router) OnStart(hook func() error) {
+	r.startHooks = append(r.startHooks, hook)
+}
+
+// OnStop registers a hook run during graceful shutdown, after in-flight
+// requests have drained. Hooks run once, in reverse registration order, so
+// resources opened by earlier hooks are closed last.
+func (r *Router) OnStop(hook func()) {
+	r.stopHooks = append(r.stopHooks, hook)
+}
+
+// runStartHooks runs the OnStart hooks, stopping at the first error
+func (r *Router) runStartHooks() error {
+	for _, hook := range r.startHooks {
+		if err := hook(); err != nil {
+			return fmt.Errorf("microweb: start hook: %w", err)
+		}
+	}
+	return nil
+}
+
+// runStopHooks runs the OnStop hooks the first time it is called
+func (r *Router) runStopHooks() {
+	r.stopOnce.Do(func() {
+		for i := len(r.stopHooks) - 1; i >= 0; i-- {
+			r.stopHooks[i]()
+		}
+	})
+}
+
+// MarkReady marks the router as ready to serve traffic gated by StartupGate
+func (r *Router) MarkReady() {
+	r.ready.Store(true)
+}
+
+// IsReady reports whether MarkReady has been called
+func (r *Router) IsReady() bool {
+	return r.ready.Load()
+}
+
+// StartupGate returns a middleware that responds 503 until MarkReady is
+// called. Requests to the allowed paths (such as the readiness endpoint) are
+// always let through.
+func (r *Router) StartupGate(allow ...string) MiddleWare {
+	return func(c *Context) bool {
+		if r.ready.Load() {
+			return true
+		}
+
+		for _, path := range allow {
+			if c.R.URL.Path == path {
+				return true
+			}
+		}
+
+		c.W.Header().Set("Retry-After", "1")
+		c.W.WriteHeader(http.StatusServiceUnavailable)
+		c.W.Write([]byte("Service Unavailable"))
+		return false
+	}
+}
+
+// ReadinessHandler responds 200 once the router is ready and 503 before
+func (r *Router) ReadinessHandler() Handler {
+	return func(c *Context) {
+		if !r.ready.Load() {
+			c.Status(http.StatusServiceUnavailable)
+			c.Json(map[string]string{"status": "starting"})
+			return
+		}
+		c.Json(map[string]string{"status": "ready"})
+	}
+}
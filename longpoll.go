@@ -0,0 +1,90 @@
+package microweb
+
+import (
+	"net/http"
+	"time"
+)
+
+// LongPoll registers a long-polling endpoint as a fallback for clients that
+// cannot use WebSockets. A GET without an id registers a new hub client and
+// returns {"id": "..."}. A GET with ?id= blocks until a message is sent to that
+// client via Hub.Send or Hub.Broadcast, or responds 204 after LongPollTimeout.
+// Clients that stop polling for longer than PongWait are unregistered. A
+// second concurrent poll for the same id gets a 409.
+func (r *Router) LongPoll(path string) {
+	ensureHub()
+
+	r.Get(path, func(ctx *Context) {
+		servePoll(Hub, ctx)
+	})
+}
+
+// servePoll handles a single long-poll request
+func servePoll(hub *WsHub, ctx *Context) {
+	id := ctx.Query("id")
+	if id == "" {
+		client := &Client{
+			Id:     newClientId(),
+			send:   make(chan []byte, 256),
+			done:   make(chan struct{}),
+			hub:    hub,
+			events: make(map[string][]EventHandler),
+		}
+		client.expiry = time.AfterFunc(hub.config.PongWait, func() {
+			if !client.isClosed() {
+				queue(hub.unregister, client, &hub.unregisterCount)
+			}
+		})
+
+		queue(hub.register, client, &hub.registerCount)
+		ctx.Json(map[string]string{"id": client.Id})
+		return
+	}
+
+	client := hub.GetClient(id)
+	if client == nil || client.expiry == nil {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+
+	if client.isClosed() {
+		ctx.Status(http.StatusGone)
+		return
+	}
+	// One poll at a time, so the expiry timer has a single owner
+	if !client.polling.CompareAndSwap(false, true) {
+		ctx.Status(http.StatusConflict)
+		return
+	}
+	defer client.polling.Store(false)
+
+	// Keep the client alive while it is polling. dropClients stops the timer
+	// after closing the client, so a Reset racing with it is undone by one
+	// side or the other.
+	client.expiry.Stop()
+	defer func() {
+		client.expiry.Reset(hub.config.PongWait)
+		if client.isClosed() {
+			client.expiry.Stop()
+		}
+	}()
+
+	timer := time.NewTimer(hub.config.LongPollTimeout)
+	defer timer.Stop()
+
+	select {
+	case message, ok := <-client.send:
+		if !ok {
+			ctx.Status(http.StatusGone)
+			return
+		}
+		ctx.W.Header().Set("Content-Type", "application/json")
+		ctx.W.WriteHeader(http.StatusOK)
+		ctx.W.Write(message)
+
+	case <-timer.C:
+		ctx.Status(http.StatusNoContent)
+
+	case <-ctx.Context().Done():
+	}
+}
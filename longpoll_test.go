@@ -0,0 +1,56 @@
+package microweb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLongPollSerializesPollsAndExpires(t *testing.T) {
+	config := DefaultWsConfig()
+	config.PongWait = 50 * time.Millisecond
+	config.LongPollTimeout = time.Second
+	hub := NewWsHub(config)
+	go hub.Run()
+
+	r := New()
+	r.Get("/poll", func(c *Context) { servePoll(hub, c) })
+	poll := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/poll"+query, nil))
+		return w
+	}
+
+	var reg map[string]string
+	if err := json.Unmarshal(poll("").Body.Bytes(), &reg); err != nil {
+		t.Fatal(err)
+	}
+	id := reg["id"]
+	waitFor(t, func() bool { return hub.GetClient(id) != nil })
+	client := hub.GetClient(id)
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- poll("?id=" + id) }()
+	waitFor(t, client.polling.Load)
+
+	if w := poll("?id=" + id); w.Code != http.StatusConflict {
+		t.Fatalf("concurrent poll: status = %d, want 409", w.Code)
+	}
+
+	hub.Send(id, "hello")
+	if w := <-first; w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Fatalf("first poll: got %d %q", w.Code, w.Body.String())
+	}
+
+	// Without further polls the client expires once and stays gone
+	waitFor(t, func() bool { return hub.GetClient(id) == nil && client.isClosed() })
+	if w := poll("?id=" + id); w.Code != http.StatusNotFound {
+		t.Fatalf("poll after expiry: status = %d, want 404", w.Code)
+	}
+	time.Sleep(2 * config.PongWait)
+	if n := hub.unregisterCount.sends.Load(); n != 1 {
+		t.Fatalf("unregister queued %d times, want 1", n)
+	}
+}
@@ -1,12 +1,16 @@
 package microweb
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -15,21 +19,55 @@ import (
 type MiddleWare func(c *Context) bool
 type Handler func(*Context)
 type PanicHandler func(c *Context, err any)
+type ErrorHandler func(c *Context, err error)
+
+// JSONPostProcessor transforms or wraps a value before ctx.Json encodes it
+type JSONPostProcessor func(c *Context, v any) any
+
+// JSONHandler returns a value to be JSON-encoded as the response. Returning an
+// error invokes the router's error handler; returning nil means the handler
+// already wrote the response.
+type JSONHandler func(*Context) any
 
 type Router struct {
-	staticisset             bool
-	staticPath              string
 	premiddleware           []MiddleWare
 	postmiddleware          []MiddleWare
 	endpoints               map[string]map[string]Handler
 	count                   atomic.Int64
 	mux                     *http.ServeMux
-	staticprefix            string
+	statics                 []*staticMount
 	groups                  []*Group
 	panicHandler            PanicHandler
 	notFoundHandler         Handler
 	methodNotAllowedHandler Handler
+	errorHandler            ErrorHandler
 	routes                  []string
+	trustedProxies          []*net.IPNet
+	templates               templateSet
+	ready                   atomic.Bool
+	table                   []*Route
+	noFaviconLog            bool
+	logSample               int64
+	logSampleOf             int64
+	logSampleCount          atomic.Int64
+	maxBodySize             int64
+	maxJSONDepth            int
+	flagProvider            FlagProvider
+	server                  *http.Server
+	addr                    atomic.Value
+	latency                 *LatencyTracker
+	clientIPHeaders         []string
+	named                   map[string]*Route
+	cursorSecret            []byte
+	requireHost             bool
+	defaultHost             string
+	jsonPostProcessor       JSONPostProcessor
+	dumps                   sync.Map // route pattern -> *dumpTarget
+	prettyJSON              bool
+	startHooks              []func() error
+	stopHooks               []func()
+	stopOnce                sync.Once
+	wsRoutes                map[string]bool // patterns of WebSocket routes
 }
 
 func New() *Router {
@@ -38,10 +76,14 @@ func New() *Router {
 		count:     atomic.Int64{},
 		mux:       http.NewServeMux(),
 		routes:    []string{},
+
+		clientIPHeaders: []string{"X-Forwarded-For", "X-Real-IP"},
 	}
 }
 
-func (r *Router) Group(prefix string) *Group {
+// Group creates a route group. Any fns are called with the new group to
+// register its routes in one block.
+func (r *Router) Group(prefix string, fns ...func(*Group)) *Group {
 	g := &Group{
 		r:          r,
 		prefix:     prefix,
@@ -52,6 +94,10 @@ func (r *Router) Group(prefix string) *Group {
 	}
 
 	r.groups = append(r.groups, g)
+
+	for _, fn := range fns {
+		fn(g)
+	}
 	return g
 }
 
@@ -67,10 +113,109 @@ func (r *Router) SetPanicHandler(handler PanicHandler) {
 	r.panicHandler = handler
 }
 
+// SetErrorHandler sets the handler invoked when a JSONHandler returns an error
+func (r *Router) SetErrorHandler(handler ErrorHandler) {
+	r.errorHandler = handler
+}
+
+// SetPrettyJSON makes ctx.Json indent its output, e.g. during development
+func (r *Router) SetPrettyJSON(pretty bool) {
+	r.prettyJSON = pretty
+}
+
+// SetJSONPostProcessor sets a function that ctx.Json passes every value
+// through before encoding, e.g. to add a timestamp or the request ID. Use
+// ctx.JsonRaw to skip it for a single response.
+func (r *Router) SetJSONPostProcessor(fn JSONPostProcessor) {
+	r.jsonPostProcessor = fn
+}
+
+// SetTrustedProxies sets the proxy addresses (IPs or CIDRs) whose forwarding
+// headers such as X-Forwarded-Proto are trusted
+func (r *Router) SetTrustedProxies(proxies ...string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			if ip := net.ParseIP(p); ip != nil && ip.To4() != nil {
+				p += "/32"
+			} else {
+				p += "/128"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return err
+		}
+		nets = append(nets, n)
+	}
+
+	r.trustedProxies = nets
+	return nil
+}
+
+// SetClientIPHeaders sets the headers ClientIP reads, in order, for requests
+// from trusted proxies. Comma-separated values such as X-Forwarded-For use
+// the first hop. The default is X-Forwarded-For then X-Real-IP; with no
+// headers ClientIP always uses the connection address.
+func (r *Router) SetClientIPHeaders(headers ...string) {
+	r.clientIPHeaders = headers
+}
+
+// isTrustedProxy reports whether remoteAddr belongs to a trusted proxy
+func (r *Router) isTrustedProxy(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range r.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetMaxBodySize limits request bodies to n bytes for every method. Reading
+// past the limit fails with an error for which ctx.IsBodyTooLarge is true.
+func (r *Router) SetMaxBodySize(n int64) {
+	r.maxBodySize = n
+}
+
+// SetMaxJSONDepth rejects JSON bodies nesting objects or arrays deeper than n
+// with ErrJSONTooDeep before they are decoded. Zero disables the check.
+func (r *Router) SetMaxJSONDepth(n int) {
+	r.maxJSONDepth = n
+}
+
 func (r *Router) SetNotFoundHandler(handler Handler) {
 	r.notFoundHandler = handler
 }
 
+// panicHandlerFor returns the panic handler of the group the request was
+// routed through, falling back to the router's
+func (r *Router) panicHandlerFor(ctx *Context) PanicHandler {
+	if handler := ctx.group.panicHandlerFor(); handler != nil {
+		return handler
+	}
+	return r.panicHandler
+}
+
+// notFoundHandlerFor returns the not-found handler of the most deeply nested
+// group owning path, falling back to the router's
+func (r *Router) notFoundHandlerFor(path string) Handler {
+	if handler := groupFor(r.groups, path).notFoundHandlerFor(); handler != nil {
+		return handler
+	}
+	return r.notFoundHandler
+}
+
 func (r *Router) SetMethodNotAllowedHandler(handler Handler) {
 	r.methodNotAllowedHandler = handler
 }
@@ -98,23 +243,38 @@ func CORS(allowOrigin, allowMethods, allowHeaders string) MiddleWare {
 	}
 }
 
+// Static serves files from path at the root level. Only existing files are
+// served, so routes still match other paths. Several directories may be
+// mounted; the first containing the file wins.
 func (mw *Router) Static(path string) {
-	mw.staticPath = path
-	mw.staticisset = true
+	mw.StaticWithOptions("", path, nil)
 }
 
+// StaticWithPrefix serves files from path under prefix. Each prefix has its
+// own directory; mounting the same prefix again replaces it.
 func (mw *Router) StaticWithPrefix(prefix, path string) {
-	// Ensure prefix starts and ends with /
-	if !strings.HasPrefix(prefix, "/") {
-		prefix = "/" + prefix
+	if prefix == "" {
+		prefix = "/"
 	}
-	if !strings.HasSuffix(prefix, "/") {
-		prefix += "/"
+	mw.StaticWithOptions(prefix, path, nil)
+}
+
+// StaticWithOptions serves files from path under prefix, or at the root
+// level when prefix is empty, with options controlling directory requests.
+// Root mounts only serve existing files, so the options apply to prefix
+// mounts.
+func (mw *Router) StaticWithOptions(prefix, path string, options *StaticOptions) {
+	if prefix != "" {
+		// Ensure prefix starts and ends with /
+		if !strings.HasPrefix(prefix, "/") {
+			prefix = "/" + prefix
+		}
+		if !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
 	}
 
-	mw.staticprefix = prefix
-	mw.staticPath = path
-	mw.staticisset = true
+	mw.mountStatic(prefix, path, options)
 }
 
 func (mw *Router) fileExists(filepath string) bool {
@@ -125,39 +285,131 @@ func (mw *Router) fileExists(filepath string) bool {
 	return err == nil && !info.IsDir()
 }
 
-func (mw *Router) Get(path string, handler func(*Context)) {
+func (mw *Router) Get(path string, handler func(*Context)) *Route {
 	mw.routes = append(mw.routes, "GET "+path)
-	mw.addroute(path, http.MethodGet, handler)
+	return mw.addroute(path, http.MethodGet, handler)
 }
 
-func (mw *Router) Post(path string, handler func(*Context)) {
+func (mw *Router) Post(path string, handler func(*Context)) *Route {
 	mw.routes = append(mw.routes, "POST "+path)
-	mw.addroute(path, http.MethodPost, handler)
+	return mw.addroute(path, http.MethodPost, handler)
 }
 
-func (mw *Router) Put(path string, handler func(*Context)) {
+func (mw *Router) Put(path string, handler func(*Context)) *Route {
 	mw.routes = append(mw.routes, "PUT "+path)
-	mw.addroute(path, http.MethodPut, handler)
+	return mw.addroute(path, http.MethodPut, handler)
 }
 
-func (mw *Router) Delete(path string, handler func(*Context)) {
+func (mw *Router) Delete(path string, handler func(*Context)) *Route {
 	mw.routes = append(mw.routes, "DELETE "+path)
-	mw.addroute(path, http.MethodDelete, handler)
+	return mw.addroute(path, http.MethodDelete, handler)
 }
 
-func (mw *Router) Head(path string, handler func(*Context)) {
+func (mw *Router) Head(path string, handler func(*Context)) *Route {
 	mw.routes = append(mw.routes, "HEAD "+path)
-	mw.addroute(path, http.MethodHead, handler)
+	return mw.addroute(path, http.MethodHead, handler)
 }
 
-func (mw *Router) Options(path string, handler func(*Context)) {
+func (mw *Router) Options(path string, handler func(*Context)) *Route {
 	mw.routes = append(mw.routes, "OPTIONS "+path)
-	mw.addroute(path, http.MethodOptions, handler)
+	return mw.addroute(path, http.MethodOptions, handler)
 }
 
-func (mw *Router) Patch(path string, handler func(*Context)) {
+func (mw *Router) Patch(path string, handler func(*Context)) *Route {
 	mw.routes = append(mw.routes, "PATCH "+path)
-	mw.addroute(path, http.MethodPatch, handler)
+	return mw.addroute(path, http.MethodPatch, handler)
+}
+
+// UseOnly applies middleware to a single handler. The middlewares run after
+// the router's global middleware and stop the chain by returning false.
+func (mw *Router) UseOnly(handler Handler, middlewares ...MiddleWare) Handler {
+	return func(ctx *Context) {
+		if runChain(ctx, middlewares) {
+			handler(ctx)
+		}
+	}
+}
+
+// runChain runs middlewares in order, reporting whether the handler should
+// run. The chain stops when a middleware returns false or aborts the context.
+func runChain(ctx *Context, middlewares []MiddleWare) bool {
+	for _, m := range middlewares {
+		if !m(ctx) || ctx.IsAborted() {
+			return false
+		}
+	}
+	return true
+}
+
+// GetWith registers a GET handler with route-specific middleware
+func (mw *Router) GetWith(path string, handler Handler, middlewares ...MiddleWare) *Route {
+	return mw.Get(path, mw.UseOnly(handler, middlewares...))
+}
+
+// PostWith registers a POST handler with route-specific middleware
+func (mw *Router) PostWith(path string, handler Handler, middlewares ...MiddleWare) *Route {
+	return mw.Post(path, mw.UseOnly(handler, middlewares...))
+}
+
+// PutWith registers a PUT handler with route-specific middleware
+func (mw *Router) PutWith(path string, handler Handler, middlewares ...MiddleWare) *Route {
+	return mw.Put(path, mw.UseOnly(handler, middlewares...))
+}
+
+// PatchWith registers a PATCH handler with route-specific middleware
+func (mw *Router) PatchWith(path string, handler Handler, middlewares ...MiddleWare) *Route {
+	return mw.Patch(path, mw.UseOnly(handler, middlewares...))
+}
+
+// DeleteWith registers a DELETE handler with route-specific middleware
+func (mw *Router) DeleteWith(path string, handler Handler, middlewares ...MiddleWare) *Route {
+	return mw.Delete(path, mw.UseOnly(handler, middlewares...))
+}
+
+func (mw *Router) GetJSON(path string, handler JSONHandler) *Route {
+	return mw.Get(path, mw.jsonHandler(handler))
+}
+
+func (mw *Router) PostJSON(path string, handler JSONHandler) *Route {
+	return mw.Post(path, mw.jsonHandler(handler))
+}
+
+func (mw *Router) PutJSON(path string, handler JSONHandler) *Route {
+	return mw.Put(path, mw.jsonHandler(handler))
+}
+
+func (mw *Router) PatchJSON(path string, handler JSONHandler) *Route {
+	return mw.Patch(path, mw.jsonHandler(handler))
+}
+
+func (mw *Router) DeleteJSON(path string, handler JSONHandler) *Route {
+	return mw.Delete(path, mw.jsonHandler(handler))
+}
+
+// jsonHandler adapts a JSONHandler to a Handler
+func (mw *Router) jsonHandler(h JSONHandler) Handler {
+	return func(ctx *Context) {
+		switch v := h(ctx).(type) {
+		case nil:
+		case error:
+			mw.handleError(ctx, v)
+		default:
+			if err := ctx.Json(v); err != nil {
+				mw.handleError(ctx, err)
+			}
+		}
+	}
+}
+
+// handleError invokes the error handler, falling back to a JSON 500 response
+func (mw *Router) handleError(ctx *Context, err error) {
+	if mw.errorHandler != nil {
+		mw.errorHandler(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusInternalServerError)
+	ctx.Json(map[string]string{"error": err.Error()})
 }
 
 // Any registers a handler for all HTTP methods
@@ -207,38 +459,69 @@ func (mw *Router) Routes() []string {
 	return routes
 }
 
-func (mw *Router) addroute(path, method string, handler Handler) error {
-	mw.mux.HandleFunc(method+" "+path, mw.middle(handler))
-	return nil
+func (mw *Router) addroute(path, method string, handler Handler) *Route {
+	path, constraints := parseConstraints(path)
+
+	h := mw.middle(handler)
+	if len(constraints) > 0 {
+		h = mw.constrain(constraints, h)
+	}
+	mw.mux.HandleFunc(method+" "+path, h)
+
+	route := &Route{Method: method, Path: path, router: mw, handler: handler}
+	mw.table = append(mw.table, route)
+	return route
 }
 
-func (mw *Router) runMiddlewares(ctx *Context) bool {
+// newContext takes a Context from the pool for a request
+func (mw *Router) newContext(w http.ResponseWriter, r *http.Request) *Context {
+	ctx := contextPool.Get().(*Context)
+	ctx.R = r
+	ctx.W = w
+	ctx.rw = w
+	ctx.Method = r.Method
+	ctx.router = mw
+	return ctx
+}
 
-	for _, m := range mw.premiddleware {
-		if !m(ctx) {
-			return false
-		}
+// releaseContext returns a Context to the pool. WebSocket upgrades are not
+// pooled since the connection outlives the request.
+func (mw *Router) releaseContext(ctx *Context) {
+	if ctx.R.Header.Get("Upgrade") == "websocket" {
+		return
 	}
+	ctx.reset()
+	contextPool.Put(ctx)
+}
 
-	return true
+func (mw *Router) runMiddlewares(ctx *Context) bool {
+	return runChain(ctx, mw.premiddleware)
 }
 
 func (mw *Router) middle(fn func(*Context)) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		ctx := &Context{R: r, W: w, Method: r.Method, state: make(map[string]any)}
+		if mw.maxBodySize > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, mw.maxBodySize)
+		}
+
+		ctx := mw.newContext(w, r)
+		mw.startDump(ctx)
 
 		// Panic recovery
 		defer func() {
 			if err := recover(); err != nil {
+				ctx.recovered = err
 				log.Printf("PANIC: %v", err)
-				if mw.panicHandler != nil {
-					mw.panicHandler(ctx, err)
+				if handler := mw.panicHandlerFor(ctx); handler != nil {
+					handler(ctx, err)
 				} else {
 					ctx.W.WriteHeader(http.StatusInternalServerError)
 					ctx.W.Write([]byte("Internal Server Error"))
 				}
 			}
+			ctx.complete()
+			mw.releaseContext(ctx)
 		}()
 
 		if !mw.runMiddlewares(ctx) {
@@ -248,6 +531,9 @@ func (mw *Router) middle(fn func(*Context)) http.HandlerFunc {
 		fn(ctx)
 
 		for _, middleware := range mw.postmiddleware {
+			if ctx.IsAborted() {
+				return
+			}
 			if next := middleware(ctx); !next {
 				return
 			}
@@ -257,20 +543,17 @@ func (mw *Router) middle(fn func(*Context)) http.HandlerFunc {
 
 func (mw *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
-	// Check if static file serving is enabled
-	if mw.staticisset && mw.staticPath != "" {
-		// Check for /prefix/ based static files first
-		if mw.staticprefix != "" && strings.HasPrefix(r.URL.Path, mw.staticprefix) {
-			fileServer := http.StripPrefix(mw.staticprefix, http.FileServer(http.Dir(mw.staticPath)))
-			fileServer.ServeHTTP(w, r)
-			return
-		}
+	if !mw.checkHost(w, r) {
+		return
+	}
 
-		// Check for root-level static files based on file existence
-		// Only if no prefix is set or path doesn't match prefix
-		if mw.staticprefix == "" && mw.fileExists(mw.staticPath+r.URL.Path) {
-			fileServer := http.FileServer(http.Dir(mw.staticPath))
-			fileServer.ServeHTTP(w, r)
+	if mw.serveStatic(w, r) {
+		return
+	}
+
+	if mw.noFaviconLog && r.URL.Path == "/favicon.ico" {
+		if _, pattern := mw.mux.Handler(r); pattern == "" {
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 	}
@@ -278,16 +561,26 @@ func (mw *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	mw.count.Add(1)
 
 	start := time.Now()
+	status := http.StatusSwitchingProtocols
+	size := 0
 
 	defer func() {
-		log.Printf("%s %s %s #%d", r.Method, r.URL.Path, time.Since(start), mw.count.Load())
+		elapsed := time.Since(start)
+		if mw.latency != nil && r.Pattern != "" && status != http.StatusSwitchingProtocols {
+			mw.latency.Record(r.Pattern, elapsed)
+		}
+		if mw.shouldLog(status) {
+			if id := w.Header().Get(RequestIDHeader); id != "" {
+				log.Printf("%s %s %s %dB #%d %s", r.Method, r.URL.Path, elapsed, size, mw.count.Load(), id)
+			} else {
+				log.Printf("%s %s %s %dB #%d", r.Method, r.URL.Path, elapsed, size, mw.count.Load())
+			}
+		}
 	}()
 
-	// Check if this is a WebSocket upgrade request
-	isWebSocket := r.Header.Get("Upgrade") == "websocket"
-
-	if isWebSocket {
-		// Don't wrap for WebSocket - needs Hijacker interface
+	// Upgrade requests for WebSocket routes go straight to the mux; stray
+	// upgrade requests are handled like any other request
+	if r.Header.Get("Upgrade") == "websocket" && mw.isWsRoute(r) {
 		mw.mux.ServeHTTP(w, r)
 		return
 	}
@@ -295,37 +588,163 @@ func (mw *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Create a custom response writer to capture status code
 	crw := &customResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 	mw.mux.ServeHTTP(crw, r)
+	status = crw.statusCode
+	size = crw.bytesWritten
 
 	// Handle 404 and 405 with custom handlers
-	if crw.statusCode == http.StatusNotFound && mw.notFoundHandler != nil {
-		ctx := &Context{R: r, W: w, Method: r.Method, state: make(map[string]any)}
-		mw.notFoundHandler(ctx)
+	if crw.statusCode == http.StatusNotFound && !crw.handled {
+		if handler := mw.notFoundHandlerFor(r.URL.Path); handler != nil {
+			ctx := mw.newContext(w, r)
+			handler(ctx)
+			mw.releaseContext(ctx)
+		}
 	} else if crw.statusCode == http.StatusMethodNotAllowed && mw.methodNotAllowedHandler != nil {
-		ctx := &Context{R: r, W: w, Method: r.Method, state: make(map[string]any)}
+		ctx := mw.newContext(w, r)
 		mw.methodNotAllowedHandler(ctx)
+		mw.releaseContext(ctx)
 	}
 }
 
-// customResponseWriter wraps http.ResponseWriter to capture status code
+// isWsRoute reports whether r matches a route registered with Ws, WsWithAuth
+// or WsBinary
+func (mw *Router) isWsRoute(r *http.Request) bool {
+	if len(mw.wsRoutes) == 0 {
+		return false
+	}
+	_, pattern := mw.mux.Handler(r)
+	return mw.wsRoutes[pattern]
+}
+
+// SampleAccessLog logs only n of every m successful (2xx) requests. Requests
+// with any other status are always logged.
+func (mw *Router) SampleAccessLog(n, m int) {
+	mw.logSample = int64(n)
+	mw.logSampleOf = int64(m)
+}
+
+// shouldLog reports whether a request with the given status is logged
+func (mw *Router) shouldLog(status int) bool {
+	if status < 200 || status > 299 || mw.logSampleOf <= 1 {
+		return true
+	}
+	return (mw.logSampleCount.Add(1)-1)%mw.logSampleOf < mw.logSample
+}
+
+// customResponseWriter wraps http.ResponseWriter to capture the status code
+// and the number of body bytes written
 type customResponseWriter struct {
 	http.ResponseWriter
-	statusCode int
+	statusCode   int
+	bytesWritten int
+	written      bool
+	handled      bool // the custom not-found handler already ran
 }
 
 func (crw *customResponseWriter) WriteHeader(code int) {
-	crw.statusCode = code
+	if !crw.written {
+		crw.statusCode = code
+		crw.written = code >= 200 || code == http.StatusSwitchingProtocols
+	}
 	crw.ResponseWriter.WriteHeader(code)
 }
 
-func (mw *Router) Listen(port int) error {
+func (crw *customResponseWriter) Write(b []byte) (int, error) {
+	crw.written = true
+	n, err := crw.ResponseWriter.Write(b)
+	crw.bytesWritten += n
+	return n, err
+}
+
+// Flush implements http.Flusher when the underlying writer supports it
+func (crw *customResponseWriter) Flush() {
+	if f, ok := crw.ResponseWriter.(http.Flusher); ok {
+		crw.written = true
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker when the underlying writer supports it
+func (crw *customResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := crw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (crw *customResponseWriter) Unwrap() http.ResponseWriter {
+	return crw.ResponseWriter
+}
+
+// BytesWritten returns the number of body bytes written
+func (crw *customResponseWriter) BytesWritten() int {
+	return crw.bytesWritten
+}
+
+// Status returns the captured status code
+func (crw *customResponseWriter) Status() int {
+	return crw.statusCode
+}
+
+// Written reports whether the response has been started
+func (crw *customResponseWriter) Written() bool {
+	return crw.written
+}
+
+// statusReporter is implemented by response writers that capture the status code
+type statusReporter interface {
+	Status() int
+	Written() bool
+}
+
+// signalShutdownTimeout bounds how long in-flight requests may take to drain
+// after SIGINT or SIGTERM when serving with Listen, ListenTLS,
+// ListenTLSConfig or Serve
+const signalShutdownTimeout = 10 * time.Second
+
+// exitOnSignal runs serve. On SIGINT or SIGTERM the server is shut down
+// gracefully with Shutdown, which runs the OnStop hooks once requests have
+// drained, and the process exits. Once a signal has arrived exitOnSignal
+// does not return, so callers can't exit before draining finishes.
+func (mw *Router) exitOnSignal(serve func() error) error {
 	ex := make(chan os.Signal, 2)
 	signal.Notify(ex, os.Interrupt, syscall.SIGTERM)
 	defer signal.Stop(ex)
 
+	done := make(chan struct{})
+	signaled := make(chan struct{})
 	go func() {
-		<-ex
+		select {
+		case <-ex:
+		case <-done:
+			return
+		}
+
+		close(signaled)
+		ctx, cancel := context.WithTimeout(context.Background(), signalShutdownTimeout)
+		defer cancel()
+		if err := mw.Shutdown(ctx); err != nil {
+			log.Printf("Shutdown: %v", err)
+		}
 		os.Exit(0)
 	}()
 
-	return http.ListenAndServe(fmt.Sprintf(":%d", port), mw)
+	err := serve()
+	close(done)
+
+	select {
+	case <-signaled:
+		select {} // the shutdown goroutine exits the process
+	default:
+		return err
+	}
+}
+
+func (mw *Router) Listen(port int) error {
+	if err := mw.runStartHooks(); err != nil {
+		return err
+	}
+	srv := mw.Server()
+	srv.Addr = fmt.Sprintf(":%d", port)
+	return mw.exitOnSignal(srv.ListenAndServe)
 }
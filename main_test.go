@@ -0,0 +1,59 @@
+package microweb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJSONRoutesReturnRoute(t *testing.T) {
+	r := New()
+	handler := func(c *Context) any { return map[string]string{"id": c.Param("id")} }
+
+	r.GetJSON("/users/{id}", handler).Name("user")
+	r.PostJSON("/users", handler).Name("users.create")
+	r.PutJSON("/users/{id}", handler).Name("users.replace")
+	r.PatchJSON("/users/{id}", handler).Name("users.update")
+	r.DeleteJSON("/users/{id}", handler).Name("users.delete")
+
+	url, err := r.URL("user", "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "/users/7" {
+		t.Fatalf("URL = %q, want /users/7", url)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	if w.Code != http.StatusOK || w.Body.String() != `{"id":"7"}`+"\n" {
+		t.Fatalf("got %d %q", w.Code, w.Body.String())
+	}
+}
+
+// TestAbortStopsEveryChain checks that a middleware that aborts but returns
+// true stops the chain the same way for router, group and route middleware
+func TestAbortStopsEveryChain(t *testing.T) {
+	abort := func(c *Context) bool {
+		c.Abort()
+		return true
+	}
+	ok := func(c *Context) { c.String("handler ran") }
+
+	r := New()
+	r.Get("/only", r.UseOnly(ok, abort))
+	r.GetWith("/with", ok, abort)
+	plain := r.Group("/plain")
+	plain.Get("/only", plain.UseOnly(ok, abort))
+	g := r.Group("/g")
+	g.Use(abort)
+	g.Get("/group", ok)
+
+	for _, path := range []string{"/only", "/with", "/plain/only", "/g/group"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Body.String() == "handler ran" {
+			t.Errorf("GET %s: handler ran after Abort", path)
+		}
+	}
+}
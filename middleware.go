@@ -0,0 +1,387 @@
+package microweb
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TxKey is the context key under which Transactional stores the transaction
+const TxKey = "tx"
+
+// Tx is a unit of work that can be committed or rolled back
+type Tx interface {
+	Commit() error
+	Rollback() error
+}
+
+// Transactional begins a transaction before the handler runs and stores it
+// under TxKey. The transaction is committed when the handler finishes with a
+// 2xx status and rolled back on any other status or on panic. The response
+// is buffered in a ResponseRecorder and only sent once the transaction has
+// been resolved, so a client never sees success for work that failed to
+// commit; a failed commit replaces the response with a 500. Streaming
+// responses such as SSE don't work on routes using Transactional.
+func Transactional(begin func() (Tx, error)) MiddleWare {
+	return func(c *Context) bool {
+		tx, err := begin()
+		if err != nil {
+			log.Printf("Transactional: begin failed: %v", err)
+			c.W.WriteHeader(http.StatusInternalServerError)
+			c.W.Write([]byte("Internal Server Error"))
+			return false
+		}
+
+		rec := NewResponseRecorder(c.W)
+		c.W = rec
+
+		c.Set(TxKey, tx)
+		c.OnComplete(func(c *Context) {
+			defer rec.Commit()
+
+			status := rec.Status()
+			if c.Panicked() || status < 200 || status > 299 {
+				if err := tx.Rollback(); err != nil {
+					log.Printf("Transactional: rollback failed: %v", err)
+				}
+				return
+			}
+
+			if err := tx.Commit(); err != nil {
+				log.Printf("Transactional: commit failed: %v", err)
+				rec.Reset()
+				rec.WriteHeader(http.StatusInternalServerError)
+				rec.Write([]byte("Internal Server Error"))
+			}
+		})
+		return true
+	}
+}
+
+// Tx returns the transaction started by the Transactional middleware
+func (tc *Context) Tx() Tx {
+	if tx, ok := tc.Get(TxKey).(Tx); ok {
+		return tx
+	}
+	return nil
+}
+
+const (
+	// RequestIDKey is the context key under which RequestID stores the id
+	RequestIDKey = "request_id"
+	// RequestIDHeader is the header RequestID reads and echoes the id in
+	RequestIDHeader = "X-Request-ID"
+)
+
+// RequestID gives every request an id, taken from an incoming X-Request-ID
+// header or generated as a UUID. The id is stored under RequestIDKey, echoed
+// in the response's X-Request-ID header and included in the access log.
+// Incoming ids longer than 128 bytes or containing anything but printable
+// ASCII are replaced.
+func RequestID() MiddleWare {
+	return func(c *Context) bool {
+		id := c.R.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+
+		c.Set(RequestIDKey, id)
+		c.W.Header().Set(RequestIDHeader, id)
+		return true
+	}
+}
+
+// RequestID returns the id assigned by the RequestID middleware, or ""
+func (tc *Context) RequestID() string {
+	id, _ := tc.Get(RequestIDKey).(string)
+	return id
+}
+
+// validRequestID reports whether an incoming id is safe to log and echo
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// HTTPSMode controls how RequireHTTPS handles plain HTTP requests
+type HTTPSMode int
+
+const (
+	// HTTPSRedirect redirects plain HTTP requests to https:// with a 301
+	HTTPSRedirect HTTPSMode = iota
+	// HTTPSReject rejects plain HTTP requests with a 403
+	HTTPSReject
+)
+
+// HTTPSOptions configures the RequireHTTPSWith middleware
+type HTTPSOptions struct {
+	// Mode decides how plain HTTP requests are handled
+	Mode HTTPSMode
+
+	// HSTSMaxAge is the max-age sent in Strict-Transport-Security on HTTPS
+	// responses. Zero sends no header. Browsers remember the policy for
+	// this long, so start small.
+	HSTSMaxAge time.Duration
+
+	// HSTSIncludeSubDomains applies the policy to all subdomains
+	HSTSIncludeSubDomains bool
+}
+
+// RequireHTTPS enforces HTTPS. X-Forwarded-Proto is only honored for requests
+// from proxies registered with SetTrustedProxies.
+func RequireHTTPS(mode HTTPSMode) MiddleWare {
+	return RequireHTTPSWith(&HTTPSOptions{Mode: mode})
+}
+
+// RequireHTTPSWith enforces HTTPS like RequireHTTPS and optionally sends a
+// Strict-Transport-Security header on HTTPS responses
+func RequireHTTPSWith(options *HTTPSOptions) MiddleWare {
+	if options == nil {
+		options = &HTTPSOptions{}
+	}
+
+	var hsts string
+	if options.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.FormatInt(int64(options.HSTSMaxAge/time.Second), 10)
+		if options.HSTSIncludeSubDomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+	mode := options.Mode
+
+	return func(c *Context) bool {
+		if c.IsSecure() {
+			// Browsers ignore the header over plain HTTP
+			if hsts != "" {
+				c.W.Header().Set("Strict-Transport-Security", hsts)
+			}
+			return true
+		}
+
+		if mode == HTTPSReject {
+			c.W.WriteHeader(http.StatusForbidden)
+			c.W.Write([]byte("HTTPS Required"))
+			return false
+		}
+
+		c.Redirect("https://"+c.R.Host+c.R.URL.RequestURI(), http.StatusMovedPermanently)
+		return false
+	}
+}
+
+// requestScopedHeader reports whether a response header belongs to a single
+// request and must not be replayed to SingleFlight followers
+func requestScopedHeader(key string) bool {
+	switch http.CanonicalHeaderKey(key) {
+	case "Set-Cookie", http.CanonicalHeaderKey(RequestIDHeader), "Traceparent", "Tracestate":
+		return true
+	}
+	return false
+}
+
+// flight is an in-progress request shared by SingleFlight callers
+type flight struct {
+	done   chan struct{}
+	status int
+	header http.Header
+	body   []byte
+}
+
+// SingleFlight makes concurrent identical GET and HEAD requests (same method,
+// path and query) share one handler execution. The first request runs the
+// handler while the others wait and receive a copy of its response. The
+// first request's response is fully buffered in a ResponseRecorder until the
+// handler chain completes, so streaming responses such as SSE or flushed
+// output don't work on routes using SingleFlight. Set-Cookie and request-scoped
+// headers such as X-Request-ID are not copied, so one client's session
+// cookie never reaches another; the response body is shared as-is, so don't
+// use SingleFlight on routes whose output depends on who is asking.
+//
+// golang.org/x/sync/singleflight is not used because it runs the shared work
+// inside a function it calls, while here the handler runs on the first
+// request's goroutine after the middleware has returned.
+func SingleFlight() MiddleWare {
+	var mu sync.Mutex
+	inflight := make(map[string]*flight)
+
+	return func(c *Context) bool {
+		if c.Method != http.MethodGet && c.Method != http.MethodHead {
+			return true
+		}
+
+		key := c.Method + " " + c.R.URL.RequestURI()
+
+		mu.Lock()
+		if f, ok := inflight[key]; ok {
+			mu.Unlock()
+
+			select {
+			case <-f.done:
+			case <-c.Context().Done():
+				return false
+			}
+
+			dst := c.W.Header()
+			for k, v := range f.header {
+				if !requestScopedHeader(k) {
+					dst[k] = v
+				}
+			}
+			c.W.WriteHeader(f.status)
+			c.W.Write(f.body)
+			return false
+		}
+
+		f := &flight{done: make(chan struct{})}
+		inflight[key] = f
+		mu.Unlock()
+
+		rec := NewResponseRecorder(c.W)
+		c.W = rec
+
+		c.OnComplete(func(c *Context) {
+			rec.Commit()
+			f.status = rec.Status()
+			f.header = rec.Header().Clone()
+			f.body = rec.Body()
+
+			mu.Lock()
+			delete(inflight, key)
+			mu.Unlock()
+			close(f.done)
+		})
+		return true
+	}
+}
+
+// MapStatus rewrites responses with status from to status to, e.g. to turn
+// an upstream 204 into a 200 for legacy clients
+func MapStatus(from, to int) MiddleWare {
+	return func(c *Context) bool {
+		c.W = &statusMapWriter{ResponseWriter: c.W, from: from, to: to}
+		return true
+	}
+}
+
+// statusMapWriter substitutes one status code for another
+type statusMapWriter struct {
+	http.ResponseWriter
+	from, to    int
+	wroteHeader bool
+}
+
+func (sw *statusMapWriter) WriteHeader(code int) {
+	if sw.wroteHeader {
+		return
+	}
+	sw.wroteHeader = true
+
+	if code == sw.from {
+		code = sw.to
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusMapWriter) Write(b []byte) (int, error) {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+func (sw *statusMapWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack passes through to the underlying writer so WebSocket upgrades work
+// on routes using MapStatus
+func (sw *statusMapWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(sw.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (sw *statusMapWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+func (sw *statusMapWriter) Status() int {
+	if sr, ok := sw.ResponseWriter.(statusReporter); ok {
+		return sr.Status()
+	}
+	return http.StatusOK
+}
+
+func (sw *statusMapWriter) Written() bool {
+	return sw.wroteHeader
+}
+
+// ConcurrencyCheck enforces optimistic concurrency on writes. When the request
+// carries If-Match, current is called to get the resource's ETag, or "" when
+// the resource doesn't exist, and the request is rejected with 412 unless it
+// matches.
+func ConcurrencyCheck(current func(*Context) string) MiddleWare {
+	return func(c *Context) bool {
+		ifMatch := c.IfMatch()
+		if ifMatch == "" {
+			return true
+		}
+
+		if etagMatch(ifMatch, current(c)) {
+			return true
+		}
+
+		c.PreconditionFailed()
+		return false
+	}
+}
+
+// etagMatch reports whether an If-Match header matches etag using strong
+// comparison. "*" matches any existing resource, even one with a weak ETag.
+func etagMatch(header, etag string) bool {
+	if etag == "" {
+		return false
+	}
+
+	candidates := strings.Split(header, ",")
+	for _, candidate := range candidates {
+		if strings.TrimSpace(candidate) == "*" {
+			return true
+		}
+	}
+
+	if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	etag = quoteETag(etag)
+
+	for _, candidate := range candidates {
+		if strings.TrimSpace(candidate) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteETag wraps an ETag in double quotes if it is not already
+func quoteETag(etag string) string {
+	if strings.HasPrefix(etag, `"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
@@ -0,0 +1,249 @@
+package microweb
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSingleFlightDoesNotReplayRequestScopedHeaders(t *testing.T) {
+	var calls atomic.Int32
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	r := New()
+	r.Use(RequestID(), SingleFlight())
+	r.Get("/report", func(c *Context) {
+		if calls.Add(1) == 1 {
+			close(entered)
+		}
+		<-release
+		http.SetCookie(c.W, &http.Cookie{Name: "session", Value: "leader-secret"})
+		c.W.Header().Set("Cache-Control", "max-age=60")
+		c.String("report")
+	})
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/report", nil))
+		return w
+	}
+
+	leader := make(chan *httptest.ResponseRecorder, 1)
+	go func() { leader <- get() }()
+	<-entered
+
+	const numFollowers = 4
+	followers := make([]*httptest.ResponseRecorder, numFollowers)
+	var wg sync.WaitGroup
+	for i := range followers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			followers[i] = get()
+		}()
+	}
+	time.Sleep(50 * time.Millisecond) // let the followers join the flight
+	close(release)
+	wg.Wait()
+	lw := <-leader
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("handler ran %d times, want 1", n)
+	}
+	if lw.Header().Get("Set-Cookie") == "" {
+		t.Error("leader lost its own Set-Cookie")
+	}
+
+	for i, w := range followers {
+		if w.Code != http.StatusOK || w.Body.String() != "report" {
+			t.Errorf("follower %d: got %d %q", i, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Cache-Control"); got != "max-age=60" {
+			t.Errorf("follower %d: Cache-Control = %q, want the shared value", i, got)
+		}
+		if got := w.Header().Values("Set-Cookie"); len(got) != 0 {
+			t.Errorf("follower %d: received the leader's Set-Cookie %q", i, got)
+		}
+		id := w.Header().Get(RequestIDHeader)
+		if id == "" || id == lw.Header().Get(RequestIDHeader) {
+			t.Errorf("follower %d: X-Request-ID = %q, want its own id", i, id)
+		}
+	}
+}
+
+func TestRequireHTTPSHSTS(t *testing.T) {
+	hsts := func(options *HTTPSOptions, secure bool) (int, string) {
+		r := New()
+		r.Use(RequireHTTPSWith(options))
+		r.Get("/", func(c *Context) { c.String("ok") })
+
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		if secure {
+			req.TLS = &tls.ConnectionState{}
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code, w.Header().Get("Strict-Transport-Security")
+	}
+
+	if _, got := hsts(&HTTPSOptions{}, true); got != "" {
+		t.Errorf("HSTS sent by default: %q", got)
+	}
+
+	options := &HTTPSOptions{HSTSMaxAge: 365 * 24 * time.Hour, HSTSIncludeSubDomains: true}
+	if code, got := hsts(options, true); code != http.StatusOK || got != "max-age=31536000; includeSubDomains" {
+		t.Errorf("HTTPS: got %d %q", code, got)
+	}
+
+	options.HSTSIncludeSubDomains = false
+	if _, got := hsts(options, true); got != "max-age=31536000" {
+		t.Errorf("without subdomains: got %q", got)
+	}
+
+	if code, got := hsts(options, false); code != http.StatusMovedPermanently || got != "" {
+		t.Errorf("plain HTTP: got %d %q, want a redirect without HSTS", code, got)
+	}
+}
+
+// fakeTx records how a transaction ended and whether the response had
+// already reached the client when it did
+type fakeTx struct {
+	w          *httptest.ResponseRecorder
+	commitErr  error
+	committed  bool
+	rolledBack bool
+	sentEarly  bool
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.sentEarly = tx.w.Body.Len() > 0
+	tx.committed = true
+	return tx.commitErr
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.rolledBack = true
+	return nil
+}
+
+func TestTransactionalResolvesBeforeResponding(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		commitErr    error
+		wantStatus   int
+		wantBody     string
+		wantCommit   bool
+		wantRollback bool
+	}{
+		{"commit", http.StatusOK, nil, http.StatusOK, "saved", true, false},
+		{"commit fails", http.StatusOK, errors.New("conflict"), http.StatusInternalServerError, "Internal Server Error", true, false},
+		{"rollback", http.StatusBadRequest, nil, http.StatusBadRequest, "saved", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tx := &fakeTx{w: w, commitErr: tt.commitErr}
+
+			r := New()
+			r.Use(Transactional(func() (Tx, error) { return tx, nil }))
+			r.Get("/", func(c *Context) {
+				c.W.Header().Set("X-Saved", "1")
+				c.W.WriteHeader(tt.status)
+				c.W.Write([]byte("saved"))
+			})
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if w.Code != tt.wantStatus || w.Body.String() != tt.wantBody {
+				t.Fatalf("got %d %q, want %d %q", w.Code, w.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+			if tx.committed != tt.wantCommit || tx.rolledBack != tt.wantRollback {
+				t.Fatalf("committed = %v, rolled back = %v", tx.committed, tx.rolledBack)
+			}
+			if tx.sentEarly {
+				t.Fatal("response was sent before the transaction was committed")
+			}
+			if tt.commitErr != nil && w.Header().Get("X-Saved") != "" {
+				t.Fatal("failed commit kept the handler's headers")
+			}
+		})
+	}
+}
+
+func TestConcurrencyCheckIfMatch(t *testing.T) {
+	tests := []struct {
+		ifMatch, current string
+		want             int
+	}{
+		{`"v1"`, "v1", http.StatusOK},
+		{`"v0", "v1"`, `"v1"`, http.StatusOK},
+		{`"v0"`, "v1", http.StatusPreconditionFailed},
+		{"*", "v1", http.StatusOK},
+		{"*", `W/"v1"`, http.StatusOK},
+		{`W/"v1"`, `W/"v1"`, http.StatusPreconditionFailed},
+		{`"v1"`, `W/"v1"`, http.StatusPreconditionFailed},
+		{"*", "", http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		r := New()
+		r.Use(ConcurrencyCheck(func(*Context) string { return tt.current }))
+		r.Put("/doc", func(c *Context) { c.String("saved") })
+
+		req := httptest.NewRequest(http.MethodPut, "/doc", nil)
+		req.Header.Set("If-Match", tt.ifMatch)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("If-Match %s against %q: status = %d, want %d", tt.ifMatch, tt.current, w.Code, tt.want)
+		}
+	}
+}
+
+// TestMapStatusKeepsWriterFeatures checks that MapStatus doesn't hide the
+// underlying writer from http.ResponseController or WebSocket upgrades
+func TestMapStatusKeepsWriterFeatures(t *testing.T) {
+	hub := NewWsHub(DefaultWsConfig())
+	go hub.Run()
+
+	r := New()
+	r.Use(MapStatus(http.StatusNoContent, http.StatusOK))
+	r.Get("/deadline", func(c *Context) {
+		if err := http.NewResponseController(c.W).SetWriteDeadline(time.Now().Add(time.Second)); err != nil {
+			c.String(err.Error())
+			return
+		}
+		c.String("ok")
+	})
+	r.Get("/ws", func(c *Context) {
+		serveWs(hub, c, nil, func(*ClientContext) WsData { return nil }, nil)
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/deadline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" {
+		t.Errorf("SetWriteDeadline through MapStatus: %s", body)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+srv.URL[len("http"):]+"/ws", nil)
+	if err != nil {
+		t.Fatalf("WebSocket upgrade through MapStatus: %v", err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,100 @@
+package microweb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Negotiate writes data as JSON, XML or plain text, whichever the request's
+// Accept header prefers, using Json, Xml or String. JSON is used when the
+// header is missing or accepts none of them. Plain text is formatted with
+// fmt.Sprint.
+func (tc *Context) Negotiate(data any) error {
+	tc.W.Header().Add("Vary", "Accept")
+
+	switch tc.Accepts("application/json", "application/xml", "text/plain", "text/xml") {
+	case "application/xml", "text/xml":
+		return tc.Xml(data)
+	case "text/plain":
+		return tc.String(fmt.Sprint(data))
+	default:
+		return tc.Json(data)
+	}
+}
+
+// Accepts returns the type among types that the request's Accept header
+// prefers, or "" when it accepts none of them. Each type is weighed by the
+// most specific matching media range, and ties go to the earlier type.
+// Without an Accept header the first type is returned.
+func (tc *Context) Accepts(types ...string) string {
+	header := tc.R.Header.Get("Accept")
+	if header == "" {
+		if len(types) == 0 {
+			return ""
+		}
+		return types[0]
+	}
+
+	ranges := parseAccept(header)
+
+	best, bestQ := "", 0.0
+	for _, t := range types {
+		if q := acceptQuality(ranges, t); q > bestQ {
+			best, bestQ = t, q
+		}
+	}
+	return best
+}
+
+// acceptRange is one media range of an Accept header
+type acceptRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// parseAccept parses an Accept header, skipping malformed ranges
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		mediaRange, params, _ := strings.Cut(part, ";")
+		typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(mediaRange)), "/")
+		if !ok {
+			continue
+		}
+
+		r := acceptRange{typ: typ, subtype: subtype, q: 1}
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					r.q = f
+				}
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// acceptQuality returns the q-value of the most specific range matching
+// mediaType, or 0 when none does
+func acceptQuality(ranges []acceptRange, mediaType string) float64 {
+	typ, subtype, _ := strings.Cut(strings.ToLower(mediaType), "/")
+
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.typ == typ && r.subtype == subtype:
+			s = 2
+		case r.typ == typ && r.subtype == "*":
+			s = 1
+		case r.typ == "*" && r.subtype == "*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
@@ -0,0 +1,220 @@
+package microweb
+
+import (
+	"encoding"
+	"fmt"
+	"mime"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ParamInto converts the path parameter key into target, which must be a
+// pointer to a string, bool, integer, float or a type implementing
+// encoding.TextUnmarshaler such as uuid.UUID
+func (c *Context) ParamInto(key string, target any) error {
+	raw := c.R.PathValue(key)
+	if raw == "" {
+		return fmt.Errorf("microweb: param %q is missing", key)
+	}
+
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("microweb: param %q: target must be a non-nil pointer", key)
+	}
+
+	if err := setString(v.Elem(), raw); err != nil {
+		return fmt.Errorf("microweb: param %q: %w", key, err)
+	}
+	return nil
+}
+
+// ParamInt returns the path parameter key as an int
+func (c *Context) ParamInt(key string) (int, error) {
+	var n int
+	err := c.ParamInto(key, &n)
+	return n, err
+}
+
+// ParamInt64 returns the path parameter key as an int64
+func (c *Context) ParamInt64(key string) (int64, error) {
+	var n int64
+	err := c.ParamInto(key, &n)
+	return n, err
+}
+
+// ParamBool returns the path parameter key as a bool
+func (c *Context) ParamBool(key string) (bool, error) {
+	var b bool
+	err := c.ParamInto(key, &b)
+	return b, err
+}
+
+// ParamIntDefault returns the path parameter key as an int, or def when it
+// is missing or malformed
+func (c *Context) ParamIntDefault(key string, def int) int {
+	n, err := c.ParamInt(key)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// BindQuery fills the fields of the struct pointed to by target from the
+// query string. Fields are matched by their query tag, or their name when
+// untagged; a tag of "-" skips the field. Slice fields take every value of
+// repeated keys. Keys without a matching field are ignored.
+func (c *Context) BindQuery(target any) error {
+	return bindValues(c.R.URL.Query(), "query", target)
+}
+
+// Bind decodes the request body into target according to its Content-Type.
+// JSON bodies are decoded with Parse. URL-encoded and multipart form bodies
+// are bound like BindQuery, matching fields by their form tag. Other content
+// types return an error.
+func (c *Context) Bind(target any) error {
+	ct := c.R.Header.Get("Content-Type")
+	if ct == "" {
+		return fmt.Errorf("microweb: bind: missing Content-Type")
+	}
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return fmt.Errorf("microweb: bind: invalid Content-Type %q: %w", ct, err)
+	}
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return c.Parse(target)
+
+	case mediaType == "application/x-www-form-urlencoded":
+		if err := c.R.ParseForm(); err != nil {
+			return bodyError(err)
+		}
+		c.formparsed = true
+		return bindValues(c.R.PostForm, "form", target)
+
+	case mediaType == "multipart/form-data":
+		form, err := c.MultipartForm()
+		if err != nil {
+			return err
+		}
+		return bindValues(form.Value, "form", target)
+	}
+
+	return fmt.Errorf("microweb: bind: unsupported Content-Type %q", mediaType)
+}
+
+// bindValues assigns values to the fields of the struct pointed to by
+// target, matching keys by the given struct tag
+func bindValues(values url.Values, tag string, target any) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("microweb: bind target must be a non-nil pointer to a struct")
+	}
+	return bindStruct(values, tag, v.Elem())
+}
+
+func bindStruct(values url.Values, tag string, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		if tv, ok := field.Tag.Lookup(tag); ok {
+			name, _, _ = strings.Cut(tv, ",")
+		}
+		if name == "-" {
+			continue
+		}
+
+		fv := v.Field(i)
+		if field.Anonymous && fv.Kind() == reflect.Struct && field.Tag.Get(tag) == "" {
+			if err := bindStruct(values, tag, fv); err != nil {
+				return err
+			}
+			continue
+		}
+
+		raw, ok := values[name]
+		if !ok || len(raw) == 0 {
+			continue
+		}
+
+		if fv.Kind() == reflect.Slice {
+			slice := reflect.MakeSlice(fv.Type(), len(raw), len(raw))
+			for j, s := range raw {
+				if err := setString(slice.Index(j), s); err != nil {
+					return fmt.Errorf("microweb: %s %q: %w", tag, name, err)
+				}
+			}
+			fv.Set(slice)
+			continue
+		}
+
+		if err := setString(fv, raw[0]); err != nil {
+			return fmt.Errorf("microweb: %s %q: %w", tag, name, err)
+		}
+	}
+	return nil
+}
+
+// setString converts s and assigns it to v
+func setString(v reflect.Value, s string) error {
+	if v.CanAddr() {
+		if tu, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			if err := tu.UnmarshalText([]byte(s)); err != nil {
+				return fmt.Errorf("cannot convert %q to %s: %w", s, v.Type(), err)
+			}
+			return nil
+		}
+	}
+
+	var err error
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(s); err == nil {
+			v.SetBool(b)
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		if n, err = strconv.ParseInt(s, 10, v.Type().Bits()); err == nil {
+			v.SetInt(n)
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		if n, err = strconv.ParseUint(s, 10, v.Type().Bits()); err == nil {
+			v.SetUint(n)
+		}
+
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(s, v.Type().Bits()); err == nil {
+			v.SetFloat(f)
+		}
+
+	case reflect.Pointer:
+		elem := reflect.New(v.Type().Elem())
+		if err = setString(elem.Elem(), s); err == nil {
+			v.Set(elem)
+		}
+		return err
+
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	if err != nil {
+		return fmt.Errorf("cannot convert %q to %s", s, v.Type())
+	}
+	return nil
+}
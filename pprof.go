@@ -0,0 +1,45 @@
+package microweb
+
+import (
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// Pprof mounts the net/http/pprof handlers under prefix (e.g. "/debug/pprof"),
+// guarded by auth. Profiles expose memory contents, goroutine stacks and the
+// command line, and profiling can be used to load the server, so they must
+// never be served unprotected. When auth is nil every request is refused.
+func (mw *Router) Pprof(prefix string, auth MiddleWare) *Group {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	if auth == nil {
+		log.Printf("pprof at %s has no auth middleware; all requests will be refused", prefix)
+		auth = func(c *Context) bool {
+			http.Error(c.W, "Forbidden", http.StatusForbidden)
+			return false
+		}
+	}
+
+	g := mw.Group(prefix)
+	g.Use(auth)
+
+	g.Get("/{$}", wrapHandler(pprof.Index))
+	g.Get("/cmdline", wrapHandler(pprof.Cmdline))
+	g.Get("/profile", wrapHandler(pprof.Profile))
+	g.Get("/symbol", wrapHandler(pprof.Symbol))
+	g.Post("/symbol", wrapHandler(pprof.Symbol))
+	g.Get("/trace", wrapHandler(pprof.Trace))
+	g.Get("/{name}", func(c *Context) {
+		pprof.Handler(c.Param("name")).ServeHTTP(c.W, c.R)
+	})
+	return g
+}
+
+// wrapHandler adapts an http.HandlerFunc to a Handler
+func wrapHandler(h http.HandlerFunc) Handler {
+	return func(c *Context) {
+		h(c.W, c.R)
+	}
+}
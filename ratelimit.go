@@ -0,0 +1,110 @@
+package microweb
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit allows each client IP rps requests per second on average, with
+// bursts of up to burst requests. Requests over the limit get a 429 with a
+// Retry-After header and the chain stops. Client IPs come from
+// ctx.ClientIP, so set trusted proxies when running behind one.
+func RateLimit(rps, burst int) MiddleWare {
+	return RateLimitBy(rps, burst, func(c *Context) string {
+		return c.ClientIP()
+	})
+}
+
+// RateLimitBy is like RateLimit but buckets requests by key, e.g. a user id
+// for per-user limits. Requests for which key returns "" are not limited.
+// Buckets idle long enough to have refilled are dropped, so memory stays
+// bounded by the number of recently active keys.
+func RateLimitBy(rps, burst int, key func(*Context) string) MiddleWare {
+	if rps < 1 {
+		rps = 1
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	l := &rateLimiter{
+		rate:    float64(rps),
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+	// A bucket idle this long is full again and can be recreated on demand
+	l.idle = time.Duration(float64(burst) / float64(rps) * float64(time.Second))
+	l.sweepEvery = max(l.idle, time.Minute)
+
+	return func(c *Context) bool {
+		k := key(c)
+		if k == "" {
+			return true
+		}
+
+		wait, ok := l.allow(k, time.Now())
+		if ok {
+			return true
+		}
+
+		c.W.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.W.WriteHeader(http.StatusTooManyRequests)
+		c.W.Write([]byte("Too Many Requests"))
+		return false
+	}
+}
+
+// rateLimiter holds one token bucket per key
+type rateLimiter struct {
+	mu         sync.Mutex
+	rate       float64
+	burst      float64
+	buckets    map[string]*tokenBucket
+	idle       time.Duration
+	sweepEvery time.Duration
+	lastSweep  time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow takes a token from the bucket for key, or reports how long until one
+// is available
+func (l *rateLimiter) allow(key string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= l.sweepEvery {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second)), false
+}
+
+// sweep drops buckets that have been idle long enough to refill
+func (l *rateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= l.idle {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,103 @@
+package microweb
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// ResponseRecorder buffers a response so middleware can inspect or replace
+// the status, headers and body before they reach the client. Nothing is sent
+// until Commit is called.
+type ResponseRecorder struct {
+	w           http.ResponseWriter
+	initial     http.Header // headers w had when the recorder was created
+	header      http.Header
+	body        bytes.Buffer
+	status      int
+	wroteHeader bool
+	committed   bool
+}
+
+// NewResponseRecorder creates a recorder that buffers the response for w.
+// Headers already set on w are copied into the recorder.
+func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
+	initial := w.Header().Clone()
+	return &ResponseRecorder{
+		w:       w,
+		initial: initial,
+		header:  initial.Clone(),
+		status:  http.StatusOK,
+	}
+}
+
+func (rr *ResponseRecorder) Header() http.Header {
+	return rr.header
+}
+
+func (rr *ResponseRecorder) WriteHeader(code int) {
+	if rr.wroteHeader {
+		return
+	}
+	rr.status = code
+	rr.wroteHeader = true
+}
+
+func (rr *ResponseRecorder) Write(b []byte) (int, error) {
+	rr.wroteHeader = true
+	return rr.body.Write(b)
+}
+
+// Status returns the recorded status code, 200 if none was written
+func (rr *ResponseRecorder) Status() int {
+	return rr.status
+}
+
+// Written reports whether a status or body has been recorded
+func (rr *ResponseRecorder) Written() bool {
+	return rr.wroteHeader
+}
+
+// Body returns the recorded body
+func (rr *ResponseRecorder) Body() []byte {
+	return rr.body.Bytes()
+}
+
+// Reset discards the recorded status and body, and restores the headers to
+// those w had when the recorder was created, so headers set by earlier
+// middleware, such as Vary from Gzip, are kept
+func (rr *ResponseRecorder) Reset() {
+	rr.header = rr.initial.Clone()
+	rr.body.Reset()
+	rr.status = http.StatusOK
+	rr.wroteHeader = false
+}
+
+// Unwrap returns the underlying writer
+func (rr *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return rr.w
+}
+
+// Commit writes the recorded headers, status and body to the underlying
+// writer. Only the first call has an effect.
+func (rr *ResponseRecorder) Commit() error {
+	if rr.committed {
+		return nil
+	}
+	rr.committed = true
+
+	dst := rr.w.Header()
+	for k := range dst {
+		if _, ok := rr.header[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, v := range rr.header {
+		dst[k] = v
+	}
+
+	if rr.wroteHeader {
+		rr.w.WriteHeader(rr.status)
+	}
+	_, err := rr.w.Write(rr.body.Bytes())
+	return err
+}
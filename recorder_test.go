@@ -0,0 +1,76 @@
+package microweb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseRecorderBuffersUntilCommit(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("X-Before", "1")
+
+	rr := NewResponseRecorder(w)
+	if got := rr.Header().Get("X-Before"); got != "1" {
+		t.Fatalf("X-Before = %q, want headers copied from w", got)
+	}
+	if rr.Status() != http.StatusOK || rr.Written() {
+		t.Fatalf("Status = %d, Written = %v before any write", rr.Status(), rr.Written())
+	}
+
+	rr.Header().Set("Content-Type", "text/plain")
+	rr.Header().Del("X-Before")
+	rr.WriteHeader(http.StatusCreated)
+	rr.WriteHeader(http.StatusTeapot)
+	rr.Write([]byte("hello"))
+
+	if w.Body.Len() != 0 || w.Header().Get("Content-Type") != "" {
+		t.Fatal("response reached w before Commit")
+	}
+	if rr.Status() != http.StatusCreated {
+		t.Fatalf("Status = %d, want the first WriteHeader", rr.Status())
+	}
+
+	if err := rr.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	rr.Commit()
+
+	if w.Code != http.StatusCreated || w.Body.String() != "hello" {
+		t.Fatalf("got %d %q, want 201 %q", w.Code, w.Body.String(), "hello")
+	}
+	if w.Header().Get("Content-Type") != "text/plain" {
+		t.Fatalf("Content-Type = %q", w.Header().Get("Content-Type"))
+	}
+	if w.Header().Get("X-Before") != "" {
+		t.Fatal("header deleted in the recorder was committed")
+	}
+}
+
+func TestResponseRecorderResetKeepsInitialHeaders(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("Vary", "Accept-Encoding")
+
+	rr := NewResponseRecorder(w)
+	rr.Header().Set("X-Error", "1")
+	rr.Header().Del("Vary")
+	rr.WriteHeader(http.StatusInternalServerError)
+	rr.Write([]byte("failed"))
+
+	rr.Reset()
+	if rr.Written() || rr.Status() != http.StatusOK || len(rr.Body()) != 0 {
+		t.Fatalf("Reset left status %d, body %q", rr.Status(), rr.Body())
+	}
+	if rr.Header().Get("X-Error") != "" {
+		t.Fatal("Reset kept a recorded header")
+	}
+	if got := rr.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Fatalf("Vary = %q after Reset, want the header from construction", got)
+	}
+
+	rr.Write([]byte("ok"))
+	rr.Commit()
+	if w.Body.String() != "ok" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("committed %q with Vary %q", w.Body.String(), w.Header().Get("Vary"))
+	}
+}
@@ -0,0 +1,264 @@
+package microweb
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Route describes a registered route
+type Route struct {
+	Method          string
+	Path            string
+	RequestExample  any
+	ResponseExample any
+
+	name    string
+	router  *Router
+	group   *Group
+	handler Handler
+}
+
+// Example attaches example request and response payloads shown by the docs page
+func (rt *Route) Example(request, response any) *Route {
+	rt.RequestExample = request
+	rt.ResponseExample = response
+	return rt
+}
+
+// Name names the route so its URL can be built with Router.URL. Names must be
+// unique; registering a name twice panics.
+func (rt *Route) Name(name string) *Route {
+	if rt.router.named == nil {
+		rt.router.named = make(map[string]*Route)
+	}
+	if _, exists := rt.router.named[name]; exists {
+		panic(fmt.Sprintf("microweb: route name %q already registered", name))
+	}
+	rt.name = name
+	rt.router.named[name] = rt
+	return rt
+}
+
+// URL builds the path of the route registered under name, substituting its
+// path parameters in order with params. Values are path-escaped, except for
+// a trailing {name...} wildcard which may contain slashes.
+func (mw *Router) URL(name string, params ...string) (string, error) {
+	rt, ok := mw.named[name]
+	if !ok {
+		return "", fmt.Errorf("microweb: no route named %q", name)
+	}
+
+	var b strings.Builder
+	path := strings.ReplaceAll(rt.Path, "{$}", "")
+	n := 0
+	for {
+		start := strings.Index(path, "{")
+		if start < 0 {
+			b.WriteString(path)
+			break
+		}
+		end := strings.Index(path[start:], "}")
+		if end < 0 {
+			b.WriteString(path)
+			break
+		}
+		end += start
+
+		param := path[start+1 : end]
+		if n >= len(params) {
+			return "", fmt.Errorf("microweb: route %q: missing value for param %q", name, strings.TrimSuffix(param, "..."))
+		}
+
+		b.WriteString(path[:start])
+		if strings.HasSuffix(param, "...") {
+			b.WriteString(params[n])
+		} else {
+			b.WriteString(url.PathEscape(params[n]))
+		}
+		n++
+		path = path[end+1:]
+	}
+
+	if n < len(params) {
+		return "", fmt.Errorf("microweb: route %q: got %d params, want %d", name, len(params), n)
+	}
+	return b.String(), nil
+}
+
+// Params returns the names of the path parameters in the route pattern
+func (rt *Route) Params() []string {
+	var params []string
+	path := rt.Path
+	for {
+		start := strings.Index(path, "{")
+		if start < 0 {
+			return params
+		}
+		end := strings.Index(path[start:], "}")
+		if end < 0 {
+			return params
+		}
+
+		name := strings.TrimSuffix(path[start+1:start+end], "...")
+		if name != "$" {
+			params = append(params, name)
+		}
+		path = path[start+end+1:]
+	}
+}
+
+// GetOptional registers a GET handler for a pattern whose trailing segments
+// may be marked optional with a "?" suffix, e.g. "/posts/{id}/{slug?}" is
+// registered as both "/posts/{id}" and "/posts/{id}/{slug}". Absent optional
+// params read as "" from ctx.Param. The returned Route is the one for the
+// full pattern, so a name set on it builds URLs with every param.
+func (mw *Router) GetOptional(path string, handler Handler) *Route {
+	var rt *Route
+	for _, p := range expandOptional(path) {
+		rt = mw.Get(p, handler)
+	}
+	return rt
+}
+
+// expandOptional expands trailing optional segments into concrete patterns
+func expandOptional(path string) []string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	required := len(segments)
+	for required > 0 && strings.HasSuffix(segments[required-1], "?}") {
+		segments[required-1] = strings.TrimSuffix(segments[required-1], "?}") + "}"
+		required--
+	}
+
+	var patterns []string
+	for n := required; n <= len(segments); n++ {
+		p := "/" + strings.Join(segments[:n], "/")
+		if p == "/" {
+			p = "/{$}"
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns
+}
+
+// RouteTable returns all registered routes in registration order
+func (mw *Router) RouteTable() []*Route {
+	table := make([]*Route, len(mw.table))
+	copy(table, mw.table)
+	return table
+}
+
+// RouteInfo is the structured form of a route served by DebugRoutesHandler
+type RouteInfo struct {
+	Method     string   `json:"method"`
+	Path       string   `json:"path"`
+	Group      string   `json:"group,omitempty"`
+	Params     []string `json:"params,omitempty"`
+	Middleware int      `json:"middleware"`
+}
+
+// RouteInfos returns a RouteInfo for every registered route in registration
+// order. Middleware counts the global, group and post middlewares that run
+// for the route.
+func (mw *Router) RouteInfos() []RouteInfo {
+	infos := make([]RouteInfo, 0, len(mw.table))
+	for _, rt := range mw.table {
+		info := RouteInfo{
+			Method:     rt.Method,
+			Path:       rt.Path,
+			Params:     rt.Params(),
+			Middleware: len(mw.premiddleware) + len(mw.postmiddleware),
+		}
+		if rt.group != nil {
+			info.Group = rt.group.prefix
+			info.Middleware += rt.group.middlewareCount()
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// RoutesJSON returns the route table encoded as a JSON array
+func (mw *Router) RoutesJSON() []byte {
+	b, _ := json.Marshal(mw.RouteInfos())
+	return b
+}
+
+// DebugRoutesHandler serves the route table as JSON
+func (mw *Router) DebugRoutesHandler() Handler {
+	return func(ctx *Context) {
+		ctx.W.Header().Set("Content-Type", "application/json")
+		ctx.W.Write(mw.RoutesJSON())
+	}
+}
+
+var docsTemplate = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>API Reference</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+.route { border-bottom: 1px solid #ddd; padding: 1em 0; }
+.method { font-weight: bold; display: inline-block; min-width: 5em; }
+pre { background: #f6f6f6; padding: 0.5em; }
+</style>
+</head>
+<body>
+<h1>API Reference</h1>
+{{range .}}<div class="route">
+<div><span class="method">{{.Method}}</span> <code>{{.Path}}</code></div>
+{{if .Params}}<p>Parameters: {{range $i, $p := .Params}}{{if $i}}, {{end}}<code>{{$p}}</code>{{end}}</p>{{end}}
+{{if .Request}}<p>Request example:</p><pre>{{.Request}}</pre>{{end}}
+{{if .Response}}<p>Response example:</p><pre>{{.Response}}</pre>{{end}}
+</div>
+{{end}}</body>
+</html>
+`))
+
+// DocsHandler registers a GET route at path serving an HTML page that lists
+// every route with its parameters and attached examples
+func (mw *Router) DocsHandler(path string) {
+	mw.Get(path, func(ctx *Context) {
+		type doc struct {
+			Method, Path      string
+			Params            []string
+			Request, Response string
+		}
+
+		table := mw.RouteTable()
+		sort.SliceStable(table, func(i, j int) bool {
+			return table[i].Path < table[j].Path
+		})
+
+		docs := make([]doc, 0, len(table))
+		for _, rt := range table {
+			docs = append(docs, doc{
+				Method:   rt.Method,
+				Path:     rt.Path,
+				Params:   rt.Params(),
+				Request:  exampleJSON(rt.RequestExample),
+				Response: exampleJSON(rt.ResponseExample),
+			})
+		}
+
+		ctx.W.Header().Set("Content-Type", "text/html; charset=utf-8")
+		docsTemplate.Execute(ctx.W, docs)
+	})
+}
+
+// exampleJSON formats an example payload as indented JSON
+func exampleJSON(v any) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
@@ -0,0 +1,33 @@
+package microweb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetOptional(t *testing.T) {
+	r := New()
+	handler := func(c *Context) { c.String(c.Param("id") + "|" + c.Param("slug")) }
+
+	r.GetOptional("/posts/{id}/{slug?}", handler).Name("post")
+	r.Group("/api").GetOptional("/posts/{id}/{slug?}", handler).Name("api.post")
+
+	url, err := r.URL("post", "42", "hello")
+	if err != nil || url != "/posts/42/hello" {
+		t.Fatalf("URL = %q, %v", url, err)
+	}
+
+	for path, want := range map[string]string{
+		"/posts/42":           "42|",
+		"/posts/42/hello":     "42|hello",
+		"/api/posts/42":       "42|",
+		"/api/posts/42/hello": "42|hello",
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("GET %s: got %d %q, want %q", path, w.Code, w.Body.String(), want)
+		}
+	}
+}
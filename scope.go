@@ -0,0 +1,215 @@
+package microweb
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// JSONScoped writes v as JSON, omitting struct fields whose scope tag names
+// none of the granted scopes. A field tagged `scope:"admin,support"` is
+// included when either scope is granted; untagged fields are always included.
+// The filter applies to structs nested at any depth, including inside
+// pointers, slices, arrays and maps with string keys. Values that implement
+// json.Marshaler or encoding.TextMarshaler are encoded as-is. Object keys are
+// written in sorted order. Like encoding/json, values that contain
+// themselves are an error and nothing is written.
+func (tc *Context) JSONScoped(v any, scopes ...string) error {
+	sc := &scoper{
+		granted: make(map[string]bool, len(scopes)),
+		walking: make(map[visit]bool),
+	}
+	for _, s := range scopes {
+		sc.granted[s] = true
+	}
+
+	out := sc.value(reflect.ValueOf(v))
+	if sc.err != nil {
+		return sc.err
+	}
+	return tc.Json(out)
+}
+
+// scoper filters a value for JSONScoped
+type scoper struct {
+	granted map[string]bool
+	walking map[visit]bool // pointers, slices and maps on the current path
+	err     error          // set when a cycle is found
+}
+
+// enter marks v as being walked, recording an error if v is part of a cycle
+func (sc *scoper) enter(v reflect.Value) (visit, bool) {
+	key, ok := enter(v, sc.walking)
+	if !ok && sc.err == nil {
+		sc.err = fmt.Errorf("microweb: JSONScoped: encountered a cycle via %s", v.Type())
+	}
+	return key, ok
+}
+
+// value converts v into plain JSON values with out-of-scope fields removed
+func (sc *scoper) value(v reflect.Value) any {
+	if !v.IsValid() || sc.err != nil {
+		return nil
+	}
+
+	t := v.Type()
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return sc.value(v.Elem())
+
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		key, ok := sc.enter(v)
+		if !ok {
+			return nil
+		}
+		defer delete(sc.walking, key)
+		return sc.value(v.Elem())
+
+	case reflect.Struct:
+		out := make(map[string]any)
+		sc.fields(v, out)
+		return out
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		if v.Len() > 0 {
+			key, ok := sc.enter(v)
+			if !ok {
+				return nil
+			}
+			defer delete(sc.walking, key)
+		}
+		fallthrough
+
+	case reflect.Array:
+		out := make([]any, v.Len())
+		for i := range out {
+			out[i] = sc.value(v.Index(i))
+		}
+		return out
+
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		if t.Key().Kind() != reflect.String {
+			return v.Interface()
+		}
+		key, ok := sc.enter(v)
+		if !ok {
+			return nil
+		}
+		defer delete(sc.walking, key)
+
+		out := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out[iter.Key().String()] = sc.value(iter.Value())
+		}
+		return out
+	}
+
+	return v.Interface()
+}
+
+// fields adds the in-scope fields of struct v to out, following the
+// encoding/json rules for names, omitempty and embedded structs
+func (sc *scoper) fields(v reflect.Value, out map[string]any) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if !inScope(field.Tag.Get("scope"), sc.granted) {
+			continue
+		}
+
+		fv := v.Field(i)
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if fv.Kind() == reflect.Pointer {
+					if fv.IsNil() {
+						continue
+					}
+					key, ok := sc.enter(fv)
+					if !ok {
+						return
+					}
+					sc.fields(fv.Elem(), out)
+					delete(sc.walking, key)
+					continue
+				}
+				sc.fields(fv, out)
+				continue
+			}
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.Contains(","+opts+",", ",omitempty,") && isEmptyJSON(fv) {
+			continue
+		}
+
+		out[name] = sc.value(fv)
+	}
+}
+
+// isEmptyJSON reports whether omitempty drops v
+func isEmptyJSON(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
+
+// inScope reports whether a field with the given scope tag is visible
+func inScope(tag string, granted map[string]bool) bool {
+	if tag == "" {
+		return true
+	}
+	for _, s := range strings.Split(tag, ",") {
+		if granted[strings.TrimSpace(s)] {
+			return true
+		}
+	}
+	return false
+}
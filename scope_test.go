@@ -0,0 +1,50 @@
+package microweb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type scopedNode struct {
+	Name   string      `json:"name"`
+	Secret string      `json:"secret" scope:"admin"`
+	Next   *scopedNode `json:"next,omitempty"`
+	Extra  any         `json:"extra,omitempty"`
+}
+
+func TestJSONScopedCycles(t *testing.T) {
+	scoped := func(v any, scopes ...string) (*httptest.ResponseRecorder, error) {
+		w := httptest.NewRecorder()
+		c := &Context{W: w, R: httptest.NewRequest(http.MethodGet, "/", nil)}
+		return w, c.JSONScoped(v, scopes...)
+	}
+
+	// A value shared by two fields is not a cycle
+	shared := &scopedNode{Name: "leaf", Secret: "s"}
+	w, err := scoped(&scopedNode{Name: "root", Next: shared, Extra: shared})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"extra":{"name":"leaf"},"name":"root","next":{"name":"leaf"}}` + "\n"
+	if w.Body.String() != want {
+		t.Fatalf("body = %s, want %s", w.Body.String(), want)
+	}
+
+	a := &scopedNode{Name: "a"}
+	a.Next = &scopedNode{Name: "b", Next: a}
+	m := map[string]any{}
+	m["self"] = m
+	s := []any{nil}
+	s[0] = s
+
+	for name, v := range map[string]any{"pointer": a, "map": m, "slice": s} {
+		w, err := scoped(v)
+		if err == nil {
+			t.Errorf("%s cycle: no error", name)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("%s cycle: wrote %s", name, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package microweb
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ServerConfig holds server timeouts and limits. Zero values keep the
+// net/http defaults (no timeouts). WriteTimeout also bounds WebSocket and SSE
+// responses, so routes serving them need a long or zero WriteTimeout.
+type ServerConfig struct {
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	MaxHeaderBytes    int
+}
+
+// ListenWithConfig serves on port like Listen with the given timeouts applied
+func (mw *Router) ListenWithConfig(port int, cfg ServerConfig) error {
+	srv := mw.Server()
+	srv.ReadTimeout = cfg.ReadTimeout
+	srv.WriteTimeout = cfg.WriteTimeout
+	srv.IdleTimeout = cfg.IdleTimeout
+	srv.ReadHeaderTimeout = cfg.ReadHeaderTimeout
+	srv.MaxHeaderBytes = cfg.MaxHeaderBytes
+
+	return mw.Listen(port)
+}
+
+// Server returns the *http.Server used by Listen, Start and
+// ListenWithShutdown, creating it on first use so it can be tuned beforehand
+func (mw *Router) Server() *http.Server {
+	if mw.server == nil {
+		mw.server = &http.Server{Handler: mw}
+	}
+	return mw.server
+}
+
+// ListenTLS serves HTTPS on port using the given certificate and key files,
+// with the same signal handling as Listen
+func (mw *Router) ListenTLS(port int, certFile, keyFile string) error {
+	if err := mw.runStartHooks(); err != nil {
+		return err
+	}
+	srv := mw.Server()
+	srv.Addr = fmt.Sprintf(":%d", port)
+	return mw.exitOnSignal(func() error {
+		return srv.ListenAndServeTLS(certFile, keyFile)
+	})
+}
+
+// ListenTLSConfig serves HTTPS on addr using cfg, for certificates loaded
+// from memory or managed by autocert (cfg.GetCertificate)
+func (mw *Router) ListenTLSConfig(addr string, cfg *tls.Config) error {
+	if err := mw.runStartHooks(); err != nil {
+		return err
+	}
+	srv := mw.Server()
+	srv.Addr = addr
+	srv.TLSConfig = cfg
+	return mw.exitOnSignal(func() error {
+		return srv.ListenAndServeTLS("", "")
+	})
+}
+
+// ListenWithShutdown serves on port until SIGINT or SIGTERM, then shuts down
+// gracefully: WebSocket clients are closed and in-flight requests get up to
+// timeout to finish
+func (mw *Router) ListenWithShutdown(port int, timeout time.Duration) error {
+	if err := mw.runStartHooks(); err != nil {
+		return err
+	}
+
+	srv := mw.Server()
+	srv.Addr = fmt.Sprintf(":%d", port)
+
+	ex := make(chan os.Signal, 2)
+	signal.Notify(ex, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(ex)
+
+	done := make(chan struct{})
+	defer close(done)
+
+	signaled := make(chan struct{})
+	shutdownErr := make(chan error, 1)
+	go func() {
+		select {
+		case <-ex:
+		case <-done:
+			return
+		}
+
+		close(signaled)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		shutdownErr <- mw.Shutdown(ctx)
+	}()
+
+	err := srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	// Wait for a signal-triggered shutdown to finish draining
+	select {
+	case <-signaled:
+		return <-shutdownErr
+	default:
+		return nil
+	}
+}
+
+// Shutdown closes all WebSocket connections with the "service restart"
+// close code, then gracefully shuts down the server, waiting for in-flight
+// requests until ctx is done. The OnStop hooks run once requests have
+// drained or ctx is done.
+func (mw *Router) Shutdown(ctx context.Context) error {
+	if Hub != nil {
+		Hub.Shutdown(nil)
+	}
+	err := mw.Server().Shutdown(ctx)
+	mw.runStopHooks()
+	return err
+}
+
+// Serve serves on a caller-provided listener, with the same signal handling
+// as Listen. Wrap the listener with a PROXY protocol decoder when running
+// behind an L4 proxy such as an AWS NLB or HAProxy; RemoteAddr, and so
+// ctx.ClientIP, then reflect the real client.
+func (mw *Router) Serve(ln net.Listener) error {
+	if err := mw.runStartHooks(); err != nil {
+		return err
+	}
+	srv := mw.Server()
+	return mw.exitOnSignal(func() error {
+		return srv.Serve(ln)
+	})
+}
+
+// Start binds the listener synchronously and serves in a goroutine. ready is
+// closed once the listener accepts connections; a bind failure or the error
+// that ends serving is delivered on errc. Port 0 picks a free port, see Addr.
+func (mw *Router) Start(port int) (<-chan struct{}, <-chan error) {
+	ready := make(chan struct{})
+	errc := make(chan error, 1)
+
+	if err := mw.runStartHooks(); err != nil {
+		errc <- err
+		return ready, errc
+	}
+
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		errc <- err
+		return ready, errc
+	}
+
+	mw.addr.Store(ln.Addr().String())
+	close(ready)
+
+	go func() {
+		errc <- mw.Server().Serve(ln)
+	}()
+	return ready, errc
+}
+
+// Addr returns the address the router is listening on after Start, or ""
+func (mw *Router) Addr() string {
+	addr, _ := mw.addr.Load().(string)
+	return addr
+}
@@ -0,0 +1,204 @@
+package microweb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrStreamClosed is returned when sending on a closed SSE stream
+var ErrStreamClosed = errors.New("microweb: stream closed")
+
+// SSEOptions configures a server-sent events stream
+type SSEOptions struct {
+	// KeepAlive is the interval between ": keepalive" comments sent to stop
+	// proxies from closing idle streams. Zero disables keepalives.
+	KeepAlive time.Duration
+}
+
+// DefaultSSEOptions returns default SSE options
+func DefaultSSEOptions() *SSEOptions {
+	return &SSEOptions{
+		KeepAlive: 15 * time.Second,
+	}
+}
+
+// SSEStream is a server-sent events stream on a response. It is safe to
+// send events from multiple goroutines.
+type SSEStream struct {
+	w      http.ResponseWriter
+	mu     sync.Mutex
+	done   chan struct{}
+	closed bool
+}
+
+// SSEStream starts a server-sent events stream. Keepalive comments are sent
+// until the client disconnects or Close is called. The server's WriteTimeout
+// must allow long-lived responses.
+func (tc *Context) SSEStream(options *SSEOptions) *SSEStream {
+	if options == nil {
+		options = DefaultSSEOptions()
+	}
+
+	h := tc.W.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	tc.W.WriteHeader(http.StatusOK)
+
+	s := &SSEStream{w: tc.W, done: make(chan struct{})}
+	s.flush()
+
+	// Stop writing once the handler chain has finished
+	tc.OnComplete(func(c *Context) {
+		s.Close()
+	})
+
+	go s.closeOnDisconnect(tc.Context().Done())
+	if options.KeepAlive > 0 {
+		go s.keepAlive(options.KeepAlive)
+	}
+	return s
+}
+
+// Send writes an event to the stream. Strings and []byte are sent as-is,
+// other values are JSON-encoded. An empty event name sends an unnamed message.
+func (s *SSEStream) Send(event string, data any) error {
+	msg, err := formatSSE(event, data)
+	if err != nil {
+		return err
+	}
+	return s.write(msg)
+}
+
+// SSE writes a single server-sent event and flushes it, sending the
+// event-stream headers with the first event. Handlers typically loop until
+// ctx.Context().Done(). Data is encoded as with SSEStream.Send; use
+// SSEStream for keepalives or sending from several goroutines. The server's
+// WriteTimeout must allow long-lived responses.
+func (tc *Context) SSE(event string, data any) error {
+	msg, err := formatSSE(event, data)
+	if err != nil {
+		return err
+	}
+
+	if !tc.Written() {
+		h := tc.W.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		h.Set("Connection", "keep-alive")
+		tc.W.WriteHeader(http.StatusOK)
+	}
+
+	if _, err := io.WriteString(tc.W, msg); err != nil {
+		return err
+	}
+	tc.Flush()
+	return nil
+}
+
+// formatSSE frames an event. Strings and []byte are sent as-is, other values
+// are JSON-encoded, and multi-line data is split into several data lines.
+func formatSSE(event string, data any) (string, error) {
+	var payload string
+	switch v := data.(type) {
+	case string:
+		payload = v
+	case []byte:
+		payload = string(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		payload = string(b)
+	}
+
+	var sb strings.Builder
+	if event != "" {
+		fmt.Fprintf(&sb, "event: %s\n", event)
+	}
+	for _, line := range strings.Split(payload, "\n") {
+		fmt.Fprintf(&sb, "data: %s\n", line)
+	}
+	sb.WriteString("\n")
+	return sb.String(), nil
+}
+
+// Close stops the stream and its keepalive loop. It does not end the response;
+// that happens when the handler returns.
+func (s *SSEStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+}
+
+// Done is closed when the client disconnects or the stream is closed
+func (s *SSEStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// closeOnDisconnect closes the stream when the client disconnects
+func (s *SSEStream) closeOnDisconnect(disconnected <-chan struct{}) {
+	select {
+	case <-disconnected:
+		s.Close()
+	case <-s.done:
+	}
+}
+
+// keepAlive sends periodic comments until the stream is closed
+func (s *SSEStream) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.write(": keepalive\n\n"); err != nil {
+				s.Close()
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// write writes raw data to the stream and flushes it
+func (s *SSEStream) write(data string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrStreamClosed
+	}
+
+	if _, err := s.w.Write([]byte(data)); err != nil {
+		return err
+	}
+	s.flushLocked()
+	return nil
+}
+
+// flush flushes buffered data to the client
+func (s *SSEStream) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushLocked()
+}
+
+func (s *SSEStream) flushLocked() {
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
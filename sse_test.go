@@ -0,0 +1,43 @@
+package microweb
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSSEStreamDoneClosesOnDisconnectWithoutKeepAlive(t *testing.T) {
+	closed := make(chan bool, 1)
+
+	r := New()
+	r.Get("/events", func(c *Context) {
+		s := c.SSEStream(&SSEOptions{KeepAlive: 0})
+		select {
+		case <-s.Done():
+			closed <- true
+		case <-time.After(2 * time.Second):
+			closed <- false
+		}
+	})
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/events", nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	cancel()
+	res.Body.Close()
+
+	if !<-closed {
+		t.Error("Done was not closed after the client disconnected")
+	}
+}
@@ -0,0 +1,167 @@
+package microweb
+
+import (
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// StaticOptions configures how a static mount serves directories
+type StaticOptions struct {
+	// DisableDirListing responds 404 to directory requests that have no
+	// index file instead of listing the directory's contents
+	DisableDirListing bool
+
+	// IndexFile is the file served for directory requests. It defaults to
+	// index.html.
+	IndexFile string
+}
+
+// staticMount serves a directory under a URL prefix. Root mounts have an
+// empty prefix and only serve files that exist.
+type staticMount struct {
+	prefix  string
+	dir     string
+	handler http.Handler
+}
+
+// mountStatic adds or replaces the mount for prefix. Prefix mounts are kept
+// longest first so nested prefixes match before their parents.
+func (mw *Router) mountStatic(prefix, dir string, options *StaticOptions) {
+	handler := mw.staticFiles(prefix, dir, options)
+	if prefix != "" {
+		handler = http.StripPrefix(prefix, handler)
+	}
+	mount := &staticMount{prefix: prefix, dir: dir, handler: handler}
+
+	for i, m := range mw.statics {
+		if prefix != "" && m.prefix == prefix {
+			mw.statics[i] = mount
+			return
+		}
+	}
+
+	mw.statics = append(mw.statics, mount)
+	sort.SliceStable(mw.statics, func(i, j int) bool {
+		return len(mw.statics[i].prefix) > len(mw.statics[j].prefix)
+	})
+}
+
+// staticFiles returns a file server for dir that applies options to
+// directory requests. Requests reach it with prefix stripped.
+func (mw *Router) staticFiles(prefix, dir string, options *StaticOptions) http.Handler {
+	fsys := http.Dir(dir)
+	files := http.FileServer(fsys)
+	if options == nil || (!options.DisableDirListing && options.IndexFile == "") {
+		return files
+	}
+
+	index := options.IndexFile
+	if index == "" {
+		index = "index.html"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Let the file server handle files, missing paths and the
+		// redirect that adds a trailing slash to directories
+		name := path.Clean("/" + r.URL.Path)
+		if info, err := statFS(fsys, name); err != nil || !info.IsDir() || !strings.HasSuffix(r.URL.Path, "/") {
+			files.ServeHTTP(w, r)
+			return
+		}
+
+		indexName := path.Join(name, index)
+		if info, err := statFS(fsys, indexName); err == nil && !info.IsDir() {
+			if index == "index.html" {
+				files.ServeHTTP(w, r)
+				return
+			}
+			f, err := fsys.Open(indexName)
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			defer f.Close()
+			http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+			return
+		}
+
+		if options.DisableDirListing {
+			// The not-found handler is chosen by the full request path
+			mw.serveNotFound(w, unstripPrefix(r, prefix))
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// unstripPrefix returns a copy of r with the prefix removed by
+// http.StripPrefix put back
+func unstripPrefix(r *http.Request, prefix string) *http.Request {
+	if prefix == "" {
+		return r
+	}
+
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = prefix + r.URL.Path
+	if r.URL.RawPath != "" {
+		r2.URL.RawPath = prefix + r.URL.RawPath
+	}
+	return r2
+}
+
+// statFS stats name in fsys
+func statFS(fsys http.FileSystem, name string) (fs.FileInfo, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// serveStatic serves r from the first matching static mount, reporting
+// whether it did
+func (mw *Router) serveStatic(w http.ResponseWriter, r *http.Request) bool {
+	for _, m := range mw.statics {
+		if m.prefix == "" {
+			if !mw.fileExists(m.dir + r.URL.Path) {
+				continue
+			}
+		} else if !strings.HasPrefix(r.URL.Path, m.prefix) {
+			continue
+		}
+
+		m.handler.ServeHTTP(w, r)
+		return true
+	}
+	return false
+}
+
+// Favicon serves the file at path for /favicon.ico with long-lived caching
+func (mw *Router) Favicon(path string) {
+	mw.Get("/favicon.ico", func(ctx *Context) {
+		ctx.W.Header().Set("Cache-Control", "public, max-age=86400")
+		http.ServeFile(ctx.W, ctx.R, path)
+	})
+}
+
+// Robots serves content as /robots.txt
+func (mw *Router) Robots(content string) {
+	mw.Get("/robots.txt", func(ctx *Context) {
+		ctx.W.Header().Set("Cache-Control", "public, max-age=86400")
+		ctx.String(content)
+	})
+}
+
+// NoFaviconLog answers /favicon.ico with 204 and no access log entry. It has
+// no effect on a favicon registered with Favicon.
+func (mw *Router) NoFaviconLog() {
+	mw.noFaviconLog = true
+}
@@ -0,0 +1,41 @@
+package microweb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestDisabledDirListingUsesGroupNotFound checks that a directory without an
+// index under a prefix mount gets the not-found handler of the group owning
+// the full path, and sees that path
+func TestDisabledDirListingUsesGroupNotFound(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	r := New()
+	r.SetNotFoundHandler(func(c *Context) {
+		c.W.WriteHeader(http.StatusNotFound)
+		c.String("router")
+	})
+	docs := r.Group("/docs")
+	docs.SetNotFoundHandler(func(c *Context) {
+		c.W.WriteHeader(http.StatusNotFound)
+		c.String("docs " + c.R.URL.Path)
+	})
+	r.StaticWithOptions("/docs", dir, &StaticOptions{DisableDirListing: true})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs/sub/", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", w.Code)
+	}
+	if got, want := w.Body.String(), "docs /docs/sub/"; got != want {
+		t.Fatalf("body = %q, want %q", got, want)
+	}
+}
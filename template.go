@@ -0,0 +1,168 @@
+package microweb
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// templateSet holds the parsed page templates used by ctx.Render
+type templateSet struct {
+	mu      sync.RWMutex
+	funcs   template.FuncMap
+	layout  []string // layout file followed by partial globs
+	pages   map[string]*template.Template
+	entries map[string]string // page name -> template to execute
+	glob    string            // last glob passed to LoadTemplates
+	reload  bool              // reparse on every render
+}
+
+// SetTemplateFuncs registers functions available to all templates. Call it
+// before LoadTemplates. A built-in "url" function builds named route URLs
+// with Router.URL unless funcs overrides it.
+func (r *Router) SetTemplateFuncs(funcs template.FuncMap) {
+	r.templates.mu.Lock()
+	defer r.templates.mu.Unlock()
+	r.templates.funcs = funcs
+}
+
+// SetLayout sets a base layout and optional partial globs shared by every page.
+// Pages fill the layout by defining a "content" template, which replaces
+// {{block "content" .}} in the layout. Call it before LoadTemplates.
+func (r *Router) SetLayout(layout string, partials ...string) {
+	r.templates.mu.Lock()
+	defer r.templates.mu.Unlock()
+	r.templates.layout = append([]string{layout}, partials...)
+}
+
+// SetTemplateReload makes ctx.Render reparse the templates loaded with
+// LoadTemplates on every call, so edits show up without a restart. Meant for
+// development; parse errors are returned from Render.
+func (r *Router) SetTemplateReload(reload bool) {
+	r.templates.mu.Lock()
+	defer r.templates.mu.Unlock()
+	r.templates.reload = reload
+}
+
+// LoadTemplates parses every page matching glob once. Pages are rendered
+// with ctx.Render using their file name without extension. It fails if the
+// layout set with SetLayout doesn't exist.
+func (r *Router) LoadTemplates(glob string) error {
+	pages, err := filepath.Glob(glob)
+	if err != nil {
+		return err
+	}
+
+	r.templates.mu.Lock()
+	defer r.templates.mu.Unlock()
+
+	var shared []string
+	for i, pattern := range r.templates.layout {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		// Without the layout pages would silently render unwrapped
+		if i == 0 && len(matches) == 0 {
+			return fmt.Errorf("microweb: layout %q not found", pattern)
+		}
+		shared = append(shared, matches...)
+	}
+
+	funcs := r.templateFuncs()
+
+	set := make(map[string]*template.Template, len(pages))
+	entries := make(map[string]string, len(pages))
+	for _, page := range pages {
+		name := strings.TrimSuffix(filepath.Base(page), filepath.Ext(page))
+		files := append(append([]string{}, shared...), page)
+
+		t, err := template.New(name).Funcs(funcs).ParseFiles(files...)
+		if err != nil {
+			return err
+		}
+
+		set[name] = t
+		entries[name] = filepath.Base(files[0])
+	}
+
+	r.templates.pages = set
+	r.templates.entries = entries
+	r.templates.glob = glob
+	return nil
+}
+
+// reloadGlob returns the glob to reparse before rendering in reload mode
+func (ts *templateSet) reloadGlob() (string, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.glob, ts.reload && ts.glob != ""
+}
+
+// templateFuncs returns the functions available to templates: the built-in
+// "url" plus those set with SetTemplateFuncs. The caller must hold
+// templates.mu.
+func (r *Router) templateFuncs() template.FuncMap {
+	funcs := template.FuncMap{"url": r.templateURL}
+	for k, v := range r.templates.funcs {
+		funcs[k] = v
+	}
+	return funcs
+}
+
+// templateURL is the "url" template function; params may be of any type
+func (r *Router) templateURL(name string, params ...any) (string, error) {
+	values := make([]string, len(params))
+	for i, p := range params {
+		values[i] = fmt.Sprint(p)
+	}
+	return r.URL(name, values...)
+}
+
+// render executes the named page into a buffer
+func (ts *templateSet) render(name string, data any) ([]byte, error) {
+	ts.mu.RLock()
+	t, ok := ts.pages[name]
+	entry := ts.entries[name]
+	ts.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("microweb: template %q not found", name)
+	}
+
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, entry, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Render renders a page loaded with LoadTemplates, wrapped in the layout if
+// one is set. Nothing is written if rendering fails.
+func (tc *Context) Render(name string, data any) error {
+	body, err := tc.RenderToBytes(name, data)
+	if err != nil {
+		return err
+	}
+
+	tc.W.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err = tc.W.Write(body)
+	return err
+}
+
+// RenderToBytes renders a page like Render but returns the output instead of
+// writing it, for fragment caching or asserting on HTML in tests
+func (tc *Context) RenderToBytes(name string, data any) ([]byte, error) {
+	if tc.router == nil {
+		return nil, fmt.Errorf("microweb: template %q not found", name)
+	}
+	if glob, ok := tc.router.templates.reloadGlob(); ok {
+		if err := tc.router.LoadTemplates(glob); err != nil {
+			return nil, err
+		}
+	}
+	return tc.router.templates.render(name, data)
+}
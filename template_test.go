@@ -0,0 +1,38 @@
+package microweb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTemplatesMissingLayout(t *testing.T) {
+	dir := t.TempDir()
+	page := `{{define "content"}}hello{{end}}`
+	if err := os.WriteFile(filepath.Join(dir, "home.html"), []byte(page), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := New()
+	r.SetLayout(filepath.Join(dir, "layout.html"))
+	if err := r.LoadTemplates(filepath.Join(dir, "*.html")); err == nil {
+		t.Fatal("LoadTemplates succeeded with a missing layout")
+	}
+
+	layout := `<main>{{block "content" .}}{{end}}</main>`
+	if err := os.WriteFile(filepath.Join(dir, "layout.html"), []byte(layout), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r.SetLayout(filepath.Join(dir, "layout.html"))
+	if err := r.LoadTemplates(filepath.Join(dir, "home.html")); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := r.templates.render("home", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(out), "<main>hello</main>"; got != want {
+		t.Fatalf("rendered %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,206 @@
+package microweb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Timeout cancels the request context after d. If the handler has not
+// finished by then, a 504 response naming the matched route and the elapsed
+// time is sent and flushed to the client right away, and any later writes
+// from the handler are discarded. The handler itself keeps running on the
+// serving goroutine until it returns, so it should watch c.Context().
+//
+// The response is buffered until the handler returns or calls Flush. A
+// flush commits what was written so far, after which the response can no
+// longer be replaced by the 504. Hijacking is not supported. WebSocket
+// upgrades are passed through untouched.
+//
+// d should be shorter than the server's WriteTimeout; otherwise the server
+// may close the connection before the 504 can be written.
+func Timeout(d time.Duration) MiddleWare {
+	return func(c *Context) bool {
+		if c.R.Header.Get("Upgrade") == "websocket" {
+			return true
+		}
+
+		reqctx, cancel := context.WithTimeout(c.R.Context(), d)
+		c.R = c.R.WithContext(reqctx)
+
+		tw := &timeoutWriter{w: c.W, h: make(http.Header), code: http.StatusOK}
+		c.W = tw
+
+		route := c.R.Pattern
+		if route == "" {
+			route = c.Method + " " + c.R.URL.Path
+		}
+
+		start := time.Now()
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+
+		go func() {
+			defer close(stopped)
+			select {
+			case <-reqctx.Done():
+				if reqctx.Err() != context.DeadlineExceeded {
+					return
+				}
+				elapsed := time.Since(start)
+				if tw.timeout(route, elapsed) {
+					c.Abort()
+					log.Printf("TIMEOUT: %s after %s", route, elapsed)
+				}
+			case <-done:
+			}
+		}()
+
+		c.OnComplete(func(c *Context) {
+			close(done)
+			<-stopped
+			cancel()
+			tw.flush()
+		})
+		return true
+	}
+}
+
+// timeoutWriter buffers the handler's response so it can be replaced by a
+// timeout response if the deadline passes first
+type timeoutWriter struct {
+	mu          sync.Mutex
+	w           http.ResponseWriter
+	h           http.Header
+	buf         bytes.Buffer
+	code        int
+	wroteHeader bool
+	timedOut    bool
+	committed   bool // flushed, writes go straight to w
+	done        bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.code = code
+	tw.wroteHeader = true
+}
+
+// Flush commits the buffered response and flushes it to the client
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return
+	}
+	if !tw.committed {
+		tw.commit()
+	}
+	http.NewResponseController(tw.w).Flush()
+}
+
+// Hijack is not supported since the response may be replaced by a timeout
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, http.ErrNotSupported
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.wroteHeader = true
+	if tw.committed {
+		return tw.w.Write(b)
+	}
+	return tw.buf.Write(b)
+}
+
+// Status returns the buffered status code, or 504 after a timeout
+func (tw *timeoutWriter) Status() int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return http.StatusGatewayTimeout
+	}
+	return tw.code
+}
+
+// Written reports whether the handler or the timeout wrote a response
+func (tw *timeoutWriter) Written() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.wroteHeader || tw.timedOut
+}
+
+// timeout writes and flushes the 504 response unless the handler already
+// finished or committed its response
+func (tw *timeoutWriter) timeout(route string, elapsed time.Duration) bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.done || tw.committed {
+		return false
+	}
+	tw.timedOut = true
+
+	body, _ := json.Marshal(map[string]string{
+		"error":   "request timeout",
+		"route":   route,
+		"elapsed": elapsed.String(),
+	})
+	tw.w.Header().Set("Content-Type", "application/json")
+	tw.w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	tw.w.WriteHeader(http.StatusGatewayTimeout)
+	tw.w.Write(body)
+	http.NewResponseController(tw.w).Flush()
+	return true
+}
+
+// flush copies the buffered response to the underlying writer
+func (tw *timeoutWriter) flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	tw.done = true
+	if tw.timedOut || tw.committed {
+		return
+	}
+	tw.commit()
+}
+
+// commit copies the buffered headers and body to the underlying writer.
+// The caller must hold mu.
+func (tw *timeoutWriter) commit() {
+	tw.committed = true
+
+	dst := tw.w.Header()
+	for k, v := range tw.h {
+		dst[k] = v
+	}
+	if tw.wroteHeader {
+		tw.w.WriteHeader(tw.code)
+	}
+	tw.w.Write(tw.buf.Bytes())
+	tw.buf.Reset()
+}
@@ -0,0 +1,80 @@
+package microweb
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeoutReachesClientBeforeHandlerReturns(t *testing.T) {
+	r := New()
+	r.Use(Timeout(100 * time.Millisecond))
+	r.Get("/slow", func(c *Context) {
+		time.Sleep(time.Second)
+		c.String("too late")
+	})
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	start := time.Now()
+	res, err := http.Get(srv.URL + "/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+
+	if res.StatusCode != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504", res.StatusCode)
+	}
+	if !strings.Contains(string(body), "GET /slow") {
+		t.Errorf("body = %q, want it to name the route", body)
+	}
+	if elapsed > 700*time.Millisecond {
+		t.Errorf("504 arrived after %s, want it at the deadline", elapsed)
+	}
+}
+
+func TestTimeoutFlushCommitsResponse(t *testing.T) {
+	r := New()
+	r.Use(Timeout(100 * time.Millisecond))
+	r.Get("/stream", func(c *Context) {
+		c.W.Write([]byte("first "))
+		c.Flush()
+		time.Sleep(200 * time.Millisecond)
+		c.W.Write([]byte("second"))
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 once the response was flushed", w.Code)
+	}
+	if !strings.HasPrefix(w.Body.String(), "first ") {
+		t.Errorf("body = %q", w.Body.String())
+	}
+}
+
+func TestTimeoutRejectsHijack(t *testing.T) {
+	r := New()
+	r.Use(Timeout(time.Second))
+
+	var err error
+	r.Get("/hijack", func(c *Context) {
+		_, _, err = http.NewResponseController(c.W).Hijack()
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/hijack", nil))
+
+	if err == nil {
+		t.Error("Hijack succeeded under Timeout")
+	}
+}
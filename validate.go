@@ -0,0 +1,240 @@
+package microweb
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FieldError describes a single failed validation rule
+type FieldError struct {
+	Field   string // dotted path such as "address.zip" or "items[2].price"
+	Rule    string
+	Message string
+}
+
+// ValidationError holds every rule violation found by Validate
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Fields returns the paths of all invalid fields
+func (e *ValidationError) Fields() []string {
+	fields := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		fields[i] = fe.Field
+	}
+	return fields
+}
+
+// Validate checks target against its `validate:"..."` struct tags and
+// returns a *ValidationError listing all failures. Supported rules are
+// required, min=N, max=N (length for strings, slices and maps, value for
+// numbers) and email. Nested structs and slices are validated recursively;
+// values that contain themselves are walked once per cycle.
+func Validate(target any) error {
+	ve := &ValidationError{}
+	validateValue(reflect.ValueOf(target), "", ve, make(map[visit]bool))
+	if len(ve.Errors) > 0 {
+		return ve
+	}
+	return nil
+}
+
+// Validate validates target; see the package-level Validate
+func (tc *Context) Validate(target any) error {
+	return Validate(target)
+}
+
+// BindAndValidate binds the request body into target with Bind and then
+// validates it. Binding errors are returned as-is; validation failures are a
+// *ValidationError.
+func (tc *Context) BindAndValidate(target any) error {
+	if err := tc.Bind(target); err != nil {
+		return err
+	}
+	return Validate(target)
+}
+
+// visit identifies a pointer or slice being walked, so cycles are cut
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// enter marks v as being walked, reporting false if it already is, i.e. v is
+// part of a cycle
+func enter(v reflect.Value, walking map[visit]bool) (visit, bool) {
+	key := visit{v.Pointer(), v.Type()}
+	if walking[key] {
+		return key, false
+	}
+	walking[key] = true
+	return key, true
+}
+
+// validateValue walks structs and slices, collecting violations. walking
+// holds the pointers and slices on the current path.
+func validateValue(v reflect.Value, path string, ve *ValidationError, walking map[visit]bool) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		if v.Kind() == reflect.Pointer {
+			key, ok := enter(v, walking)
+			if !ok {
+				return
+			}
+			defer delete(walking, key)
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+
+			fv := v.Field(i)
+			fpath := joinPath(path, fieldName(sf))
+
+			if tag := sf.Tag.Get("validate"); tag != "" && tag != "-" {
+				validateField(fv, fpath, tag, ve)
+			}
+			validateValue(fv, fpath, ve, walking)
+		}
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Len() > 0 {
+			key, ok := enter(v, walking)
+			if !ok {
+				return
+			}
+			defer delete(walking, key)
+		}
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), ve, walking)
+		}
+	}
+}
+
+// validateField applies the rules in tag to a single field
+func validateField(v reflect.Value, path, tag string, ve *ValidationError) {
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+		var msg string
+		switch name {
+		case "required":
+			if v.IsZero() {
+				msg = "is required"
+			}
+
+		case "min", "max":
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				msg = fmt.Sprintf("invalid %s rule %q", name, arg)
+				break
+			}
+			msg = checkBound(v, name, n)
+
+		case "email":
+			if s := indirect(v); s.Kind() == reflect.String && s.String() != "" {
+				if _, err := mail.ParseAddress(s.String()); err != nil {
+					msg = "must be a valid email address"
+				}
+			}
+
+		case "":
+		default:
+			msg = fmt.Sprintf("unknown rule %q", name)
+		}
+
+		if msg != "" {
+			ve.Errors = append(ve.Errors, FieldError{Field: path, Rule: name, Message: msg})
+			if name == "required" {
+				return
+			}
+		}
+	}
+}
+
+// checkBound enforces min/max against a length or numeric value
+func checkBound(v reflect.Value, rule string, bound float64) string {
+	v = indirect(v)
+
+	var n float64
+	unit := ""
+	switch v.Kind() {
+	case reflect.String:
+		n, unit = float64(len([]rune(v.String()))), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n, unit = float64(v.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = v.Float()
+	default:
+		return ""
+	}
+
+	bs := strconv.FormatFloat(bound, 'f', -1, 64)
+	if rule == "min" && n < bound {
+		if unit != "" {
+			return "must have at least " + bs + unit
+		}
+		return "must be at least " + bs
+	}
+	if rule == "max" && n > bound {
+		if unit != "" {
+			return "must have at most " + bs + unit
+		}
+		return "must be at most " + bs
+	}
+	return ""
+}
+
+// indirect dereferences pointers, returning the zero Value for nil
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// fieldName returns the JSON name of a struct field, falling back to its Go name
+func fieldName(sf reflect.StructField) string {
+	if tag := sf.Tag.Get("json"); tag != "" {
+		if name, _, _ := strings.Cut(tag, ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return sf.Name
+}
+
+// joinPath appends a field name to a dotted path
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
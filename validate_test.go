@@ -0,0 +1,43 @@
+package microweb
+
+import (
+	"errors"
+	"testing"
+)
+
+type validateNode struct {
+	Name     string          `json:"name" validate:"required"`
+	Next     *validateNode   `json:"next"`
+	Children []*validateNode `json:"children"`
+	Any      any             `json:"any"`
+}
+
+func TestValidateCycles(t *testing.T) {
+	a := &validateNode{Name: "a"}
+	b := &validateNode{}
+	a.Next, b.Next = b, a
+	a.Children = []*validateNode{a, b}
+
+	loop := []any{nil}
+	loop[0] = loop
+	a.Any = loop
+
+	err := Validate(a)
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("Validate = %v, want a *ValidationError", err)
+	}
+
+	// b is reached through two paths that aren't cycles, and is reported
+	// for each
+	want := map[string]bool{"next.name": true, "children[1].name": true}
+	for _, field := range ve.Fields() {
+		if !want[field] {
+			t.Errorf("unexpected error for %s", field)
+		}
+		delete(want, field)
+	}
+	for field := range want {
+		t.Errorf("missing error for %s", field)
+	}
+}
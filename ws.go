@@ -2,9 +2,18 @@ package microweb
 
 import (
 	"encoding/json"
+	"fmt"
+	"hash/fnv"
 	"log"
+	"maps"
 	"net/http"
+	"net/url"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,8 +31,84 @@ type WsConfig struct {
 	MaxMessageSize  int64
 	ReadBufferSize  int
 	WriteBufferSize int
+	LongPollTimeout time.Duration
+
+	// DedupeWindow is the number of recent inbound message ids remembered
+	// per client. A message whose "id" was already seen is acknowledged with
+	// {"type":"ack","id":...,"duplicate":true} instead of reaching the handler.
+	// Zero disables deduplication.
+	DedupeWindow int
+
+	// OnMessageHandled is called after each message handler returns with the
+	// message's "type" (or "cmd") field and how long the handler took
+	OnMessageHandled func(clientId string, event string, dur time.Duration)
+
+	// ShutdownGrace is how long Shutdown waits after sending its notice
+	// before closing connections
+	ShutdownGrace time.Duration
+
+	// MaxConnectionsPerIP caps concurrent WebSocket connections from one
+	// client IP. Upgrades beyond the cap are rejected with 503. Zero means
+	// unlimited.
+	MaxConnectionsPerIP int
+
+	// SoftMessageSize is a per-client message size in bytes above which an
+	// "oversize" event is emitted before the handler runs. Unlike
+	// MaxMessageSize the connection stays open. Zero disables it; clients can
+	// override it with ClientContext.SetSoftLimit.
+	SoftMessageSize int64
+
+	// EnableCompression offers permessage-deflate to clients. Peers may
+	// decline it; see Client.CompressionEnabled.
+	EnableCompression bool
+
+	// CheckOrigin reports whether an upgrade request's Origin is allowed.
+	// Rejected upgrades get a 403. Nil allows every origin.
+	CheckOrigin func(r *http.Request) bool
+
+	// Buffer sizes of the hub's internal channels. With the default of zero
+	// every register, unregister, broadcast and send waits until the hub's
+	// Run loop receives it; buffering lets callers such as HTTP handlers
+	// continue while Run is busy, at the cost of new clients taking a moment
+	// to become visible to Hub.Send and Count. WsHub.Stats reports how often
+	// senders had to wait.
+	RegisterBufferSize   int
+	UnregisterBufferSize int
+	BroadcastBufferSize  int
+	SendBufferSize       int
+
+	// BroadcastWorkers is the number of goroutines that deliver broadcasts.
+	// Clients are divided between them, so a broadcast to many clients
+	// doesn't hold up the hub's Run loop. Broadcasts reach each client in
+	// order but are asynchronous to Hub.Send. Zero uses one per CPU.
+	BroadcastWorkers int
+
+	// BackpressurePolicy decides what happens when a message is sent to a
+	// client whose send buffer is full. The default disconnects the client.
+	BackpressurePolicy BackpressurePolicy
+
+	// BackpressureTimeout is how long BackpressureBlock waits for room in
+	// the send buffer before disconnecting the client. Zero uses WriteWait.
+	// Blocked sends hold up their caller, which may be a broadcast worker,
+	// and later broadcasts to that worker's clients queue up behind it.
+	// Hub.Send messages and queued broadcasts wait on separate goroutines,
+	// so the hub's Run loop is never held up.
+	BackpressureTimeout time.Duration
 }
 
+// BackpressurePolicy controls sends to a client whose send buffer is full
+type BackpressurePolicy int
+
+const (
+	// BackpressureDisconnect disconnects the client
+	BackpressureDisconnect BackpressurePolicy = iota
+	// BackpressureDropOldest discards the oldest queued message to make room
+	BackpressureDropOldest
+	// BackpressureBlock waits up to BackpressureTimeout for room, then
+	// disconnects the client
+	BackpressureBlock
+)
+
 // DefaultWsConfig returns default WebSocket configuration
 func DefaultWsConfig() *WsConfig {
 	return &WsConfig{
@@ -33,6 +118,8 @@ func DefaultWsConfig() *WsConfig {
 		MaxMessageSize:  512 * 1024, // 512 KB
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
+		LongPollTimeout: 30 * time.Second,
+		ShutdownGrace:   2 * time.Second,
 	}
 }
 
@@ -125,20 +212,139 @@ func (w WsData) ToJSON() []byte {
 	return data
 }
 
+// ToValues converts WsData to url.Values. Strings are kept, numbers and bools
+// are formatted, arrays become repeated values, and objects are encoded as
+// JSON. Null values are omitted.
+func (w WsData) ToValues() url.Values {
+	values := make(url.Values, len(w))
+	for key, v := range w {
+		if list, ok := v.([]interface{}); ok {
+			for _, item := range list {
+				if item != nil {
+					values.Add(key, valueString(item))
+				}
+			}
+			continue
+		}
+		if v != nil {
+			values.Set(key, valueString(v))
+		}
+	}
+	return values
+}
+
+// WsDataFromValues creates WsData from url.Values. Keys with one value map to
+// a string and repeated keys to an array of strings; values are not parsed
+// as numbers or bools.
+func WsDataFromValues(values url.Values) WsData {
+	data := make(WsData, len(values))
+	for key, list := range values {
+		switch len(list) {
+		case 0:
+		case 1:
+			data[key] = list[0]
+		default:
+			items := make([]interface{}, len(list))
+			for i, s := range list {
+				items[i] = s
+			}
+			data[key] = items
+		}
+	}
+	return data
+}
+
+// valueString formats a JSON value as a form value
+func valueString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	case int, int64, int32, uint, uint64, uint32, float32, json.Number:
+		return fmt.Sprint(val)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
 // EventHandler handles WebSocket lifecycle events
 type EventHandler func(ctx *ClientContext)
 
 // WsHandler is the message handler function
 type WsHandler func(ctx *ClientContext) WsData
 
-// Client represents a WebSocket client connection
+// WsBinaryHandler handles raw messages on connections registered with
+// WsBinary. A non-nil return value is sent back as a binary frame.
+type WsBinaryHandler func(ctx *ClientContext, data []byte) []byte
+
+// Client represents a WebSocket client connection.
+//
+// Every outbound message, whether from Client.Send, ClientContext.Send or
+// any hub send or broadcast, is queued through the same path and written by
+// a single writer goroutine, so all send methods are safe to call
+// concurrently. What happens when the client's send buffer is full is set by
+// WsConfig.BackpressurePolicy; by default the client is disconnected rather
+// than a message being dropped. Messages sent after the client has
+// disconnected are discarded.
 type Client struct {
-	Id     string
-	conn   *websocket.Conn
-	send   chan []byte
-	hub    *WsHub
-	events map[string][]EventHandler
-	mu     sync.RWMutex
+	Id       string
+	conn     *websocket.Conn
+	send     chan []byte
+	sendMu   sync.Mutex    // guards sends on and closing of send
+	closed   bool          // send is closed, guarded by sendMu
+	done     chan struct{} // closed when send is about to close
+	doneOnce sync.Once
+	hub      *WsHub
+	events   map[string][]EventHandler
+	mu       sync.RWMutex
+	expiry   *time.Timer // long-poll clients only
+	polling  atomic.Bool // a long-poll request is waiting
+	subs     map[string]func(WsData) bool
+	ip       string // set when per-IP limits are enabled
+	meta     map[string]any
+
+	// whether permessage-deflate was negotiated during the handshake
+	compressed bool
+
+	// soft message size limit, -1 to use WsConfig.SoftMessageSize
+	softLimit atomic.Int64
+
+	// binary connections send every frame as a binary message
+	binary bool
+
+	// close code sent when the hub closes the connection, 0 for a plain close
+	closeCode int
+
+	// recent inbound message ids, only touched by readPump
+	seenIds  []string
+	seenSet  map[string]struct{}
+	seenNext int
+
+	// Hub.Send messages waiting for room under BackpressureBlock, delivered
+	// in order by drainPending
+	pendingMu sync.Mutex
+	pending   [][]byte
+	draining  bool
+
+	dropping     atomic.Bool // an overflow unregister is pending
+	disconnected atomic.Bool // OnDisconnect hooks have run
+	detached     atomic.Bool
+	pumping      atomic.Bool
+	detach       chan struct{}
+	writerDone   chan struct{}
+}
+
+// CompressionEnabled reports whether permessage-deflate was negotiated for
+// the connection. It is false when the hub does not enable compression or
+// the peer did not offer it.
+func (c *Client) CompressionEnabled() bool {
+	return c.compressed
 }
 
 // On registers an event handler
@@ -148,6 +354,85 @@ func (c *Client) On(event string, handler EventHandler) {
 	c.events[event] = append(c.events[event], handler)
 }
 
+// Set stores a metadata value on the client
+func (c *Client) Set(key string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.meta == nil {
+		c.meta = make(map[string]any)
+	}
+	c.meta[key] = value
+}
+
+// Get returns a metadata value stored on the client, or nil
+func (c *Client) Get(key string) any {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.meta[key]
+}
+
+// messageSoftLimit returns the client's soft message size limit
+func (c *Client) messageSoftLimit(config *WsConfig) int64 {
+	if n := c.softLimit.Load(); n >= 0 {
+		return n
+	}
+	return config.SoftMessageSize
+}
+
+// checkSoftLimit emits "oversize" for messages over the soft limit. The
+// message is still handled.
+func (c *Client) checkSoftLimit(config *WsConfig, size int) {
+	if limit := c.messageSoftLimit(config); limit > 0 && int64(size) > limit {
+		c.emit("oversize", &ClientContext{
+			Id:          c.Id,
+			Data:        WsData{"size": size, "limit": limit},
+			MessageSize: size,
+			client:      c,
+		})
+	}
+}
+
+// clearMeta drops the client's metadata once it has disconnected
+func (c *Client) clearMeta() {
+	c.mu.Lock()
+	c.meta = nil
+	c.mu.Unlock()
+}
+
+// Subscribe subscribes the client to a topic. When filter is not nil, only
+// messages published to the topic for which it returns true are delivered.
+func (c *Client) Subscribe(topic string, filter func(WsData) bool) {
+	c.mu.Lock()
+	if c.subs == nil {
+		c.subs = make(map[string]func(WsData) bool)
+	}
+	c.subs[topic] = filter
+	c.mu.Unlock()
+
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+
+	// dropClients has already cleared a closed client's subscriptions
+	if c.isClosed() {
+		return
+	}
+	if c.hub.topics[topic] == nil {
+		c.hub.topics[topic] = make(map[string]*Client)
+	}
+	c.hub.topics[topic][c.Id] = c
+}
+
+// Unsubscribe removes the client from a topic
+func (c *Client) Unsubscribe(topic string) {
+	c.mu.Lock()
+	delete(c.subs, topic)
+	c.mu.Unlock()
+
+	c.hub.mu.Lock()
+	c.hub.removeFromTopic(topic, c.Id)
+	c.hub.mu.Unlock()
+}
+
 // emit triggers event handlers
 func (c *Client) emit(event string, ctx *ClientContext) {
 	c.mu.RLock()
@@ -173,23 +458,173 @@ func (c *Client) Send(data interface{}) {
 		message, _ = json.Marshal(data)
 	}
 
+	if !c.enqueue(message) {
+		c.overflow()
+	}
+}
+
+// enqueue queues message for the writer, applying the hub's backpressure
+// policy when the send buffer is full. It reports false when the client
+// should be disconnected or has already disconnected.
+func (c *Client) enqueue(message []byte) bool {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if c.closed {
+		return false
+	}
 	select {
 	case c.send <- message:
+		return true
 	default:
-		// Channel full, close connection
-		c.hub.unregister <- c
 	}
+
+	switch c.hub.config.BackpressurePolicy {
+	case BackpressureDropOldest:
+		// The writer may have made room in the meantime
+		select {
+		case <-c.send:
+		default:
+		}
+		select {
+		case c.send <- message:
+			return true
+		default:
+			return false
+		}
+
+	case BackpressureBlock:
+		timeout := c.hub.config.BackpressureTimeout
+		if timeout <= 0 {
+			timeout = c.hub.config.WriteWait
+		}
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case c.send <- message:
+			return true
+		case <-c.done:
+			return false
+		case <-timer.C:
+			return false
+		}
+	}
+	return false
+}
+
+// enqueueAsync is enqueue for the hub's Run loop, which must not block.
+// Under BackpressureBlock a message that doesn't fit right away is handed to
+// drainPending, which waits for room and keeps messages in order. It reports
+// false when the client should be disconnected.
+func (c *Client) enqueueAsync(message []byte) bool {
+	if c.hub.config.BackpressurePolicy != BackpressureBlock {
+		return c.enqueue(message)
+	}
+
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	if !c.draining {
+		// Another sender may hold sendMu while blocked, so don't wait for it
+		if c.sendMu.TryLock() {
+			closed, sent := c.closed, false
+			if !closed {
+				select {
+				case c.send <- message:
+					sent = true
+				default:
+				}
+			}
+			c.sendMu.Unlock()
+			if closed || sent {
+				return sent
+			}
+		}
+		c.draining = true
+		go c.drainPending()
+	}
+
+	// A client this far behind won't catch up
+	if len(c.pending) >= max(cap(c.send), 1) {
+		return false
+	}
+	c.pending = append(c.pending, message)
+	return true
+}
+
+// drainPending enqueues pending messages in order, disconnecting the client
+// when one times out
+func (c *Client) drainPending() {
+	for {
+		c.pendingMu.Lock()
+		if len(c.pending) == 0 {
+			c.draining = false
+			c.pendingMu.Unlock()
+			return
+		}
+		message := c.pending[0]
+		c.pending[0] = nil
+		c.pending = c.pending[1:]
+		c.pendingMu.Unlock()
+
+		if !c.enqueue(message) {
+			c.pendingMu.Lock()
+			c.pending, c.draining = nil, false
+			c.pendingMu.Unlock()
+			c.overflow()
+			return
+		}
+	}
+}
+
+// overflow disconnects a client whose send buffer is full. It must not be
+// called from the hub's Run loop.
+func (c *Client) overflow() {
+	if c.isClosed() || !c.dropping.CompareAndSwap(false, true) {
+		return
+	}
+	queue(c.hub.unregister, c, &c.hub.unregisterCount)
+}
+
+// closeSend closes the send channel, which stops the writer, reporting
+// whether this call closed it
+func (c *Client) closeSend() bool {
+	// Wake senders blocked by BackpressureBlock, which hold sendMu
+	c.doneOnce.Do(func() { close(c.done) })
+
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if c.closed {
+		return false
+	}
+	c.closed = true
+	close(c.send)
+	return true
+}
+
+// isClosed reports whether the send channel has been closed
+func (c *Client) isClosed() bool {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	return c.closed
 }
 
 // Close closes the client connection
 func (c *Client) Close() {
-	c.hub.unregister <- c
+	queue(c.hub.unregister, c, &c.hub.unregisterCount)
 }
 
 // ClientContext is passed to WebSocket handlers
 type ClientContext struct {
-	Id     string
-	Data   WsData
+	Id   string
+	Data WsData
+
+	// MessageSize is the size in bytes of the inbound message, 0 for
+	// lifecycle events
+	MessageSize int
+
 	client *Client
 }
 
@@ -203,11 +638,131 @@ func (ctx *ClientContext) Send(data interface{}) {
 	ctx.client.Send(data)
 }
 
+// correlationFields are the fields of an inbound message copied onto its
+// reply so clients can match responses to concurrent requests
+var correlationFields = []string{"id", "reqId"}
+
+// Reply sends data to this client, copying the "id" and "reqId" fields of
+// the message being handled onto it unless data already sets them. Replies
+// returned from a WsHandler are sent this way; call Reply directly to answer
+// from a goroutine or to send more than one response.
+func (ctx *ClientContext) Reply(data WsData) {
+	copied := false
+	for _, field := range correlationFields {
+		if !ctx.Data.Has(field) || data.Has(field) {
+			continue
+		}
+		// Copy first, handlers may reply with a shared map
+		if !copied {
+			reply := make(WsData, len(data)+len(correlationFields))
+			maps.Copy(reply, data)
+			data, copied = reply, true
+		}
+		data[field] = ctx.Data[field]
+	}
+	ctx.client.Send(data)
+}
+
+// BroadcastExceptSelf sends data to every connected client except this one
+func (ctx *ClientContext) BroadcastExceptSelf(data interface{}) {
+	ctx.client.hub.BroadcastExcept(ctx.Id, data)
+}
+
 // Close closes this client connection
 func (ctx *ClientContext) Close() {
 	ctx.client.Close()
 }
 
+// Detach removes the client from the hub and stops its internal read and
+// write loops, returning the underlying connection for the caller to manage.
+// It must be called from this client's message handler or event handlers.
+// After Detach, Hub.Send and Hub.Broadcast no longer reach the connection.
+func (ctx *ClientContext) Detach() *websocket.Conn {
+	return ctx.client.detachConn()
+}
+
+// detachConn stops the pumps and unregisters the client without closing the
+// connection
+func (c *Client) detachConn() *websocket.Conn {
+	if c.conn == nil || !c.detached.CompareAndSwap(false, true) {
+		return c.conn
+	}
+
+	close(c.detach)
+	if c.pumping.Load() {
+		<-c.writerDone
+	}
+	c.hub.disconnected(c)
+	queue(c.hub.unregister, c, &c.hub.unregisterCount)
+
+	c.conn.SetReadDeadline(time.Time{})
+	c.conn.SetPongHandler(nil)
+	return c.conn
+}
+
+// remember records a message id, reporting whether it was already seen
+// within the last window ids
+func (c *Client) remember(id string, window int) bool {
+	if _, ok := c.seenSet[id]; ok {
+		return true
+	}
+
+	if c.seenSet == nil {
+		c.seenSet = make(map[string]struct{}, window)
+		c.seenIds = make([]string, 0, window)
+	}
+
+	if len(c.seenIds) < window {
+		c.seenIds = append(c.seenIds, id)
+	} else {
+		delete(c.seenSet, c.seenIds[c.seenNext])
+		c.seenIds[c.seenNext] = id
+		c.seenNext = (c.seenNext + 1) % window
+	}
+	c.seenSet[id] = struct{}{}
+	return false
+}
+
+// Subscribe subscribes this client to a topic with an optional filter
+func (ctx *ClientContext) Subscribe(topic string, filter func(WsData) bool) {
+	ctx.client.Subscribe(topic, filter)
+}
+
+// Unsubscribe removes this client from a topic
+func (ctx *ClientContext) Unsubscribe(topic string) {
+	ctx.client.Unsubscribe(topic)
+}
+
+// Set stores a value on the connection. Values persist across messages and
+// are cleared when the client disconnects.
+func (ctx *ClientContext) Set(key string, value any) {
+	ctx.client.Set(key, value)
+}
+
+// Get returns a value stored on the connection, or nil
+func (ctx *ClientContext) Get(key string) any {
+	return ctx.client.Get(key)
+}
+
+// SetSoftLimit overrides WsConfig.SoftMessageSize for this client. Zero
+// disables the soft limit.
+func (ctx *ClientContext) SetSoftLimit(n int64) {
+	ctx.client.softLimit.Store(n)
+}
+
+// Join adds this client to a room
+func (ctx *ClientContext) Join(room string) {
+	hub := ctx.client.hub
+	hub.mu.Lock()
+	hub.addToRoom(room, ctx.client)
+	hub.mu.Unlock()
+}
+
+// Leave removes this client from a room
+func (ctx *ClientContext) Leave(room string) {
+	ctx.client.hub.LeaveRoom(ctx.Id, room)
+}
+
 // SendMessage represents a message to send to a specific client
 type SendMessage struct {
 	ClientId string
@@ -217,6 +772,7 @@ type SendMessage struct {
 // BroadcastMessage represents a message to broadcast to all clients
 type BroadcastMessage struct {
 	Message []byte
+	Except  string // id of a client to skip, or ""
 }
 
 // WsHub manages all WebSocket connections
@@ -226,8 +782,74 @@ type WsHub struct {
 	unregister chan *Client
 	broadcast  chan *BroadcastMessage
 	sendMsg    chan *SendMessage
+	topics     map[string]map[string]*Client
+	rooms      map[string]map[string]*Client
+	ipCounts   map[string]int
 	mu         sync.RWMutex
 	config     *WsConfig
+	shards     []*broadcastShard
+
+	onConnect    []func(*Client)
+	onDisconnect []func(*Client)
+
+	registerCount   channelCounter
+	unregisterCount channelCounter
+	broadcastCount  channelCounter
+	sendCount       channelCounter
+}
+
+// HubChannelStats describes one of the hub's internal channels
+type HubChannelStats struct {
+	Capacity int   `json:"capacity"` // buffer size
+	Queued   int   `json:"queued"`   // items waiting for the Run loop now
+	Sends    int64 `json:"sends"`    // total sends
+	Blocked  int64 `json:"blocked"`  // sends that waited for the Run loop
+}
+
+// HubStats reports saturation of the hub's internal channels. A high ratio
+// of Blocked to Sends means the channel's buffer size should be raised.
+type HubStats struct {
+	Register   HubChannelStats `json:"register"`
+	Unregister HubChannelStats `json:"unregister"`
+	Broadcast  HubChannelStats `json:"broadcast"`
+	Send       HubChannelStats `json:"send"`
+}
+
+// channelCounter counts sends on a hub channel
+type channelCounter struct {
+	sends   atomic.Int64
+	blocked atomic.Int64
+}
+
+// queue sends v on ch, counting sends that had to wait
+func queue[T any](ch chan T, v T, counter *channelCounter) {
+	counter.sends.Add(1)
+	select {
+	case ch <- v:
+	default:
+		counter.blocked.Add(1)
+		ch <- v
+	}
+}
+
+// channelStats returns the stats of a hub channel
+func channelStats[T any](ch chan T, counter *channelCounter) HubChannelStats {
+	return HubChannelStats{
+		Capacity: cap(ch),
+		Queued:   len(ch),
+		Sends:    counter.sends.Load(),
+		Blocked:  counter.blocked.Load(),
+	}
+}
+
+// Stats returns saturation metrics for the hub's internal channels
+func (h *WsHub) Stats() HubStats {
+	return HubStats{
+		Register:   channelStats(h.register, &h.registerCount),
+		Unregister: channelStats(h.unregister, &h.unregisterCount),
+		Broadcast:  channelStats(h.broadcast, &h.broadcastCount),
+		Send:       channelStats(h.sendMsg, &h.sendCount),
+	}
 }
 
 // NewWsHub creates a new WebSocket hub
@@ -235,56 +857,215 @@ func NewWsHub(config *WsConfig) *WsHub {
 	if config == nil {
 		config = DefaultWsConfig()
 	}
+	workers := config.BroadcastWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	shards := make([]*broadcastShard, workers)
+	for i := range shards {
+		shards[i] = &broadcastShard{
+			clients: make(map[string]*Client),
+			jobs:    make(chan *BroadcastMessage, 64),
+		}
+	}
+
 	return &WsHub{
+		shards:     shards,
 		clients:    make(map[string]*Client),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		broadcast:  make(chan *BroadcastMessage),
-		sendMsg:    make(chan *SendMessage),
+		register:   make(chan *Client, max(config.RegisterBufferSize, 0)),
+		unregister: make(chan *Client, max(config.UnregisterBufferSize, 0)),
+		broadcast:  make(chan *BroadcastMessage, max(config.BroadcastBufferSize, 0)),
+		sendMsg:    make(chan *SendMessage, max(config.SendBufferSize, 0)),
+		topics:     make(map[string]map[string]*Client),
+		rooms:      make(map[string]map[string]*Client),
+		ipCounts:   make(map[string]int),
 		config:     config,
 	}
 }
 
-// Run starts the hub's main loop
+// OnConnect registers fn to be called once for each new WebSocket
+// connection, before its "open" event. The client has been queued to join
+// the hub but, with a buffered RegisterBufferSize, may not be reachable
+// through Hub.Send or broadcasts yet; use the *Client directly.
+// Hooks run on the connection's goroutine and must be registered before the
+// hub starts serving.
+func (h *WsHub) OnConnect(fn func(*Client)) {
+	h.onConnect = append(h.onConnect, fn)
+}
+
+// OnDisconnect registers fn to be called once when a WebSocket connection
+// ends, after its "close" event, or when a handler detaches it. Hooks run
+// before the client removes itself from the hub, though the hub may already
+// have dropped it, e.g. after Hub.Close. They must be registered before the
+// hub starts serving.
+func (h *WsHub) OnDisconnect(fn func(*Client)) {
+	h.onDisconnect = append(h.onDisconnect, fn)
+}
+
+// connected runs the OnConnect hooks for a client
+func (h *WsHub) connected(client *Client) {
+	for _, fn := range h.onConnect {
+		fn(client)
+	}
+}
+
+// disconnected runs the OnDisconnect hooks for a client, once
+func (h *WsHub) disconnected(client *Client) {
+	if !client.disconnected.CompareAndSwap(false, true) {
+		return
+	}
+	for _, fn := range h.onDisconnect {
+		fn(client)
+	}
+}
+
+// Run starts the hub's main loop and its broadcast workers
 func (h *WsHub) Run() {
+	for _, shard := range h.shards {
+		go h.fanOut(shard)
+	}
+
 	for {
 		select {
 		case client := <-h.register:
 			h.mu.Lock()
-			h.clients[client.Id] = client
+			// With buffered channels the client may already have been
+			// unregistered
+			if !client.isClosed() {
+				h.clients[client.Id] = client
+				h.shardFor(client.Id).clients[client.Id] = client
+			}
 			h.mu.Unlock()
 
 		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client.Id]; ok {
-				delete(h.clients, client.Id)
-				close(client.send)
-			}
-			h.mu.Unlock()
+			h.dropClients(client)
 
 		case msg := <-h.broadcast:
-			h.mu.RLock()
-			for _, client := range h.clients {
-				select {
-				case client.send <- msg.Message:
-				default:
-					close(client.send)
-					delete(h.clients, client.Id)
-				}
+			for _, shard := range h.shards {
+				shard.dispatch(msg)
 			}
-			h.mu.RUnlock()
 
 		case msg := <-h.sendMsg:
 			h.mu.RLock()
-			if client, ok := h.clients[msg.ClientId]; ok {
-				select {
-				case client.send <- msg.Message:
-				default:
-					close(client.send)
-					delete(h.clients, client.Id)
-				}
-			}
+			client, ok := h.clients[msg.ClientId]
 			h.mu.RUnlock()
+			if ok && !client.enqueueAsync(msg.Message) {
+				h.dropClients(client)
+			}
+		}
+	}
+}
+
+// broadcastShard delivers broadcasts, in order, to a fixed subset of the
+// hub's clients
+type broadcastShard struct {
+	clients map[string]*Client // guarded by the hub's mu
+	jobs    chan *BroadcastMessage
+
+	// broadcasts waiting for room in jobs while the worker is held up, e.g.
+	// by BackpressureBlock, delivered in order by drainPending
+	pendingMu sync.Mutex
+	pending   []*BroadcastMessage
+	draining  bool
+}
+
+// dispatch queues a broadcast for the shard's worker without blocking the
+// hub's Run loop
+func (s *broadcastShard) dispatch(msg *BroadcastMessage) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+
+	if !s.draining {
+		select {
+		case s.jobs <- msg:
+			return
+		default:
+		}
+		s.draining = true
+		go s.drainPending()
+	}
+	s.pending = append(s.pending, msg)
+}
+
+// drainPending hands pending broadcasts to the worker in order
+func (s *broadcastShard) drainPending() {
+	for {
+		s.pendingMu.Lock()
+		if len(s.pending) == 0 {
+			s.draining = false
+			s.pendingMu.Unlock()
+			return
+		}
+		msg := s.pending[0]
+		s.pending[0] = nil
+		s.pending = s.pending[1:]
+		s.pendingMu.Unlock()
+
+		s.jobs <- msg
+	}
+}
+
+// shardFor returns the broadcast shard that owns a client id
+func (h *WsHub) shardFor(clientId string) *broadcastShard {
+	f := fnv.New32a()
+	f.Write([]byte(clientId))
+	return h.shards[f.Sum32()%uint32(len(h.shards))]
+}
+
+// fanOut delivers the shard's broadcasts, disconnecting clients whose send
+// buffer is full
+func (h *WsHub) fanOut(shard *broadcastShard) {
+	var clients, full []*Client
+	for msg := range shard.jobs {
+		h.mu.RLock()
+		for _, client := range shard.clients {
+			clients = append(clients, client)
+		}
+		h.mu.RUnlock()
+
+		for _, client := range clients {
+			if client.Id == msg.Except {
+				continue
+			}
+			if !client.enqueue(msg.Message) {
+				full = append(full, client)
+			}
+		}
+		h.dropClients(full...)
+
+		clear(clients)
+		clear(full)
+		clients, full = clients[:0], full[:0]
+	}
+}
+
+// dropClients removes clients from the hub and closes their send channels
+func (h *WsHub) dropClients(clients ...*Client) {
+	if len(clients) == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, client := range clients {
+		if h.clients[client.Id] == client {
+			delete(h.clients, client.Id)
+			delete(h.shardFor(client.Id).clients, client.Id)
+			client.clearMeta()
+		}
+		if client.closeSend() {
+			h.releaseIP(client.ip)
+		}
+		if client.expiry != nil {
+			client.expiry.Stop()
+		}
+
+		for topic := range h.topics {
+			h.removeFromTopic(topic, client.Id)
+		}
+		for room := range h.rooms {
+			h.removeFromRoom(room, client.Id)
 		}
 	}
 }
@@ -303,10 +1084,10 @@ func (h *WsHub) Send(clientId string, message interface{}) {
 		msg, _ = json.Marshal(message)
 	}
 
-	h.sendMsg <- &SendMessage{
+	queue(h.sendMsg, &SendMessage{
 		ClientId: clientId,
 		Message:  msg,
-	}
+	}, &h.sendCount)
 }
 
 // Broadcast sends a message to all connected clients
@@ -323,7 +1104,243 @@ func (h *WsHub) Broadcast(message interface{}) {
 		msg, _ = json.Marshal(message)
 	}
 
-	h.broadcast <- &BroadcastMessage{Message: msg}
+	queue(h.broadcast, &BroadcastMessage{Message: msg}, &h.broadcastCount)
+}
+
+// BroadcastExcept sends a message to all connected clients except the one
+// with excludeClientId, typically the sender. It is delivered in order with
+// Broadcast.
+func (h *WsHub) BroadcastExcept(excludeClientId string, message interface{}) {
+	queue(h.broadcast, &BroadcastMessage{Message: encodeMessage(message), Except: excludeClientId}, &h.broadcastCount)
+}
+
+// BroadcastWhere sends a message to every client for which match returns
+// true. match is evaluated without holding the hub lock.
+func (h *WsHub) BroadcastWhere(match func(*Client) bool, message interface{}) {
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients))
+	for _, client := range h.clients {
+		clients = append(clients, client)
+	}
+	h.mu.RUnlock()
+
+	var msg []byte
+	for _, client := range clients {
+		if !match(client) {
+			continue
+		}
+
+		if msg == nil {
+			msg = encodeMessage(message)
+		}
+		queue(h.sendMsg, &SendMessage{ClientId: client.Id, Message: msg}, &h.sendCount)
+	}
+}
+
+// BroadcastToMeta sends a message to every client whose metadata key equals
+// value. Numbers compare by value regardless of their Go type.
+func (h *WsHub) BroadcastToMeta(key string, value any, message interface{}) {
+	h.BroadcastWhere(func(c *Client) bool {
+		return metaEqual(c.Get(key), value)
+	}, message)
+}
+
+// metaEqual compares metadata values, treating all numeric types alike
+func metaEqual(a, b any) bool {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+		return ok && fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// toFloat converts numeric values to float64
+func toFloat(v any) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// encodeMessage converts a message to bytes the same way Send does
+func encodeMessage(message interface{}) []byte {
+	switch v := message.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	case WsData:
+		return v.ToJSON()
+	default:
+		msg, _ := json.Marshal(message)
+		return msg
+	}
+}
+
+// PublishTopic sends data to every client subscribed to topic whose filter
+// accepts it. Filters are evaluated without holding the hub lock.
+func (h *WsHub) PublishTopic(topic string, data WsData) {
+	h.mu.RLock()
+	subscribers := make([]*Client, 0, len(h.topics[topic]))
+	for _, client := range h.topics[topic] {
+		subscribers = append(subscribers, client)
+	}
+	h.mu.RUnlock()
+
+	var msg []byte
+	for _, client := range subscribers {
+		client.mu.RLock()
+		filter, ok := client.subs[topic]
+		client.mu.RUnlock()
+
+		if !ok || (filter != nil && !filter(data)) {
+			continue
+		}
+
+		if msg == nil {
+			msg = data.ToJSON()
+		}
+		queue(h.sendMsg, &SendMessage{ClientId: client.Id, Message: msg}, &h.sendCount)
+	}
+}
+
+// JoinRoom adds a connected client to a room. Membership is removed
+// automatically when the client disconnects.
+func (h *WsHub) JoinRoom(clientId, room string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if client, ok := h.clients[clientId]; ok {
+		h.addToRoom(room, client)
+	}
+}
+
+// LeaveRoom removes a client from a room
+func (h *WsHub) LeaveRoom(clientId, room string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeFromRoom(room, clientId)
+}
+
+// BroadcastToRoom sends a message to every client in a room
+func (h *WsHub) BroadcastToRoom(room string, message interface{}) {
+	h.mu.RLock()
+	members := make([]string, 0, len(h.rooms[room]))
+	for id := range h.rooms[room] {
+		members = append(members, id)
+	}
+	h.mu.RUnlock()
+
+	if len(members) == 0 {
+		return
+	}
+
+	msg := encodeMessage(message)
+	for _, id := range members {
+		queue(h.sendMsg, &SendMessage{ClientId: id, Message: msg}, &h.sendCount)
+	}
+}
+
+// RoomMembers returns the ids of the clients in a room
+func (h *WsHub) RoomMembers(room string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	members := make([]string, 0, len(h.rooms[room]))
+	for id := range h.rooms[room] {
+		members = append(members, id)
+	}
+	return members
+}
+
+// addToRoom adds a client to a room; h.mu must be held. Closed clients are
+// skipped, since dropClients has already cleared their memberships.
+func (h *WsHub) addToRoom(room string, client *Client) {
+	if client.isClosed() {
+		return
+	}
+	if h.rooms[room] == nil {
+		h.rooms[room] = make(map[string]*Client)
+	}
+	h.rooms[room][client.Id] = client
+}
+
+// removeFromRoom removes a client from a room; h.mu must be held
+func (h *WsHub) removeFromRoom(room, clientId string) {
+	if members, ok := h.rooms[room]; ok {
+		delete(members, clientId)
+		if len(members) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+}
+
+// acquireIP reserves a connection slot for ip, reporting false when the
+// per-IP cap is reached
+func (h *WsHub) acquireIP(ip string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.ipCounts[ip] >= h.config.MaxConnectionsPerIP {
+		return false
+	}
+	h.ipCounts[ip]++
+	return true
+}
+
+// releaseIP frees a connection slot for ip; h.mu must be held
+func (h *WsHub) releaseIP(ip string) {
+	if ip == "" {
+		return
+	}
+
+	h.ipCounts[ip]--
+	if h.ipCounts[ip] <= 0 {
+		delete(h.ipCounts, ip)
+	}
+}
+
+// removeFromTopic removes a client from a topic; h.mu must be held
+func (h *WsHub) removeFromTopic(topic, clientId string) {
+	if subscribers, ok := h.topics[topic]; ok {
+		delete(subscribers, clientId)
+		if len(subscribers) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+}
+
+// Notify sends a server notice to all connected clients
+func (h *WsHub) Notify(message interface{}) {
+	h.Broadcast(message)
+}
+
+// Shutdown sends notice to all clients (unless nil), waits for the
+// configured ShutdownGrace and then closes every connection with the
+// "service restart" close code so clients know to reconnect
+func (h *WsHub) Shutdown(notice interface{}) {
+	if notice != nil {
+		h.Notify(notice)
+		time.Sleep(h.config.ShutdownGrace)
+	}
+
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients))
+	for _, client := range h.clients {
+		clients = append(clients, client)
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		client.closeCode = websocket.CloseServiceRestart
+		queue(h.unregister, client, &h.unregisterCount)
+	}
 }
 
 // Close closes a specific client connection
@@ -333,7 +1350,7 @@ func (h *WsHub) Close(clientId string) {
 	h.mu.RUnlock()
 
 	if ok {
-		h.unregister <- client
+		queue(h.unregister, client, &h.unregisterCount)
 	}
 }
 
@@ -360,17 +1377,92 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-// Ws registers a WebSocket handler
-func (r *Router) Ws(path string, handler WsHandler) {
-	// Initialize global Hub if not exists
+// offersDeflate reports whether the client offered permessage-deflate. The
+// upgrader accepts the extension whenever it is offered and enabled.
+func offersDeflate(r *http.Request) bool {
+	for _, header := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, ext := range strings.Split(header, ",") {
+			name, _, _ := strings.Cut(ext, ";")
+			if strings.EqualFold(strings.TrimSpace(name), "permessage-deflate") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ensureHub initializes the global Hub if it does not exist
+func ensureHub() {
 	if Hub == nil {
 		Hub = NewWsHub(DefaultWsConfig())
 		go Hub.Run()
 	}
+}
 
-	r.Get(path, func(ctx *Context) {
-		serveWs(Hub, ctx.W, ctx.R, handler)
-	})
+// newClientId generates a unique client ID (UUID without dashes)
+func newClientId() string {
+	id := uuid.New().String()
+	return id[:8] + id[9:13] + id[14:18] + id[19:23] + id[24:]
+}
+
+// Ws registers a WebSocket handler. handler runs for every message; use
+// WsWithSetup to register lifecycle events once per connection.
+func (r *Router) Ws(path string, handler WsHandler) {
+	ensureHub()
+
+	r.wsRoute(r.Get(path, func(ctx *Context) {
+		serveWs(Hub, ctx, nil, handler, nil)
+	}))
+}
+
+// WsWithSetup registers a WebSocket handler with a setup function that runs
+// once per connection, before the "open" event, so event handlers registered
+// there with ctx.On fire exactly once per event.
+func (r *Router) WsWithSetup(path string, setup EventHandler, handler WsHandler) {
+	ensureHub()
+
+	r.wsRoute(r.Get(path, func(ctx *Context) {
+		serveWs(Hub, ctx, setup, handler, nil)
+	}))
+}
+
+// WsWithAuth registers a WebSocket handler whose upgrade requests must pass
+// auth first. When auth returns false the upgrade is skipped and a 401 is
+// sent, unless auth already wrote a response. Values auth sets on the
+// context become the client's metadata.
+func (r *Router) WsWithAuth(path string, auth MiddleWare, handler WsHandler) {
+	ensureHub()
+
+	r.wsRoute(r.Get(path, func(ctx *Context) {
+		if !auth(ctx) {
+			if !ctx.Written() {
+				http.Error(ctx.W, "Unauthorized", http.StatusUnauthorized)
+			}
+			return
+		}
+		serveWs(Hub, ctx, nil, handler, nil)
+	}))
+}
+
+// WsBinary registers a WebSocket handler for binary protocols such as
+// protobuf or msgpack. Messages are passed to handler unparsed, and
+// everything sent to the client, including Client.Send, goes out as binary
+// frames.
+func (r *Router) WsBinary(path string, handler WsBinaryHandler) {
+	ensureHub()
+
+	r.wsRoute(r.Get(path, func(ctx *Context) {
+		serveWs(Hub, ctx, nil, nil, handler)
+	}))
+}
+
+// wsRoute records rt as a WebSocket route, so upgrade requests for it
+// bypass the router's response wrapper
+func (r *Router) wsRoute(rt *Route) {
+	if r.wsRoutes == nil {
+		r.wsRoutes = make(map[string]bool)
+	}
+	r.wsRoutes[rt.Method+" "+rt.Path] = true
 }
 
 // WebSocketHub returns the global hub
@@ -378,47 +1470,86 @@ func (r *Router) WebSocketHub() *WsHub {
 	return Hub
 }
 
-// serveWs handles WebSocket requests
-func serveWs(hub *WsHub, w http.ResponseWriter, r *http.Request, handler WsHandler) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+// serveWs handles WebSocket requests. Values set on the HTTP context by
+// middleware during the upgrade request become the client's metadata.
+func serveWs(hub *WsHub, ctx *Context, setup EventHandler, handler WsHandler, binary WsBinaryHandler) {
+	var ip string
+	if hub.config.MaxConnectionsPerIP > 0 {
+		ip = ctx.ClientIP()
+		if !hub.acquireIP(ip) {
+			http.Error(ctx.W, "Too many connections", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	up := upgrader
+	up.EnableCompression = hub.config.EnableCompression
+	if hub.config.CheckOrigin != nil {
+		up.CheckOrigin = hub.config.CheckOrigin
+	}
+
+	conn, err := up.Upgrade(ctx.W, ctx.R, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
+		if ip != "" {
+			hub.mu.Lock()
+			hub.releaseIP(ip)
+			hub.mu.Unlock()
+		}
 		return
 	}
 
-	// Generate unique client ID (UUID without dashes)
-	clientId := uuid.New().String()
-	clientId = clientId[:8] + clientId[9:13] + clientId[14:18] + clientId[19:23] + clientId[24:]
-
 	client := &Client{
-		Id:     clientId,
-		conn:   conn,
-		send:   make(chan []byte, 256),
-		hub:    hub,
-		events: make(map[string][]EventHandler),
+		Id:         newClientId(),
+		conn:       conn,
+		send:       make(chan []byte, 256),
+		done:       make(chan struct{}),
+		hub:        hub,
+		events:     make(map[string][]EventHandler),
+		ip:         ip,
+		meta:       maps.Clone(ctx.state),
+		compressed: up.EnableCompression && offersDeflate(ctx.R),
+		binary:     binary != nil,
+		detach:     make(chan struct{}),
+		writerDone: make(chan struct{}),
 	}
+	client.softLimit.Store(-1)
 
-	hub.register <- client
+	queue(hub.register, client, &hub.registerCount)
+	hub.connected(client)
 
 	// Create context for open event
-	ctx := &ClientContext{
+	openCtx := &ClientContext{
 		Id:     client.Id,
 		Data:   NewWsDataFromMap(make(map[string]interface{})),
 		client: client,
 	}
 
+	if setup != nil {
+		setup(openCtx)
+	}
+
 	// Emit open event
-	client.emit("open", ctx)
+	client.emit("open", openCtx)
+
+	if client.detached.Load() {
+		return
+	}
 
 	// Start goroutines
+	client.pumping.Store(true)
 	go writePump(client, hub.config)
-	go readPump(client, hub.config, handler)
+	go readPump(client, hub.config, handler, binary)
 }
 
 // readPump reads messages from the WebSocket connection
-func readPump(client *Client, config *WsConfig, handler WsHandler) {
+func readPump(client *Client, config *WsConfig, handler WsHandler, binary WsBinaryHandler) {
 	defer func() {
-		client.hub.unregister <- client
+		if client.detached.Load() {
+			return
+		}
+		client.hub.disconnected(client)
+		queue(client.hub.unregister, client, &client.hub.unregisterCount)
 		client.conn.Close()
 	}()
 
@@ -430,7 +1561,7 @@ func readPump(client *Client, config *WsConfig, handler WsHandler) {
 	client.conn.SetReadLimit(config.MaxMessageSize)
 
 	for {
-		_, message, err := client.conn.ReadMessage()
+		messageType, message, err := client.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				// Emit error event
@@ -451,44 +1582,114 @@ func readPump(client *Client, config *WsConfig, handler WsHandler) {
 			break
 		}
 
+		// Pass binary frames, and everything on binary connections, through raw
+		if binary != nil && (messageType == websocket.BinaryMessage || handler == nil) {
+			ctx := &ClientContext{
+				Id:          client.Id,
+				Data:        WsData{},
+				MessageSize: len(message),
+				client:      client,
+			}
+			client.checkSoftLimit(config, len(message))
+
+			start := time.Now()
+			reply := binary(ctx, message)
+			if config.OnMessageHandled != nil {
+				config.OnMessageHandled(client.Id, "binary", time.Since(start))
+			}
+
+			if client.detached.Load() {
+				return
+			}
+			if reply != nil {
+				client.Send(reply)
+			}
+			continue
+		}
+
 		// Parse message as JSON
 		wsData := NewWsData(message)
 
+		// Acknowledge replayed messages without running the handler
+		if config.DedupeWindow > 0 && wsData.Has("id") {
+			if client.remember(fmt.Sprint(wsData.Get("id")), config.DedupeWindow) {
+				client.Send(WsData{"type": "ack", "id": wsData.Get("id"), "duplicate": true})
+				continue
+			}
+		}
+
 		// Create context
 		ctx := &ClientContext{
-			Id:     client.Id,
-			Data:   wsData,
-			client: client,
+			Id:          client.Id,
+			Data:        wsData,
+			MessageSize: len(message),
+			client:      client,
 		}
 
+		client.checkSoftLimit(config, len(message))
+
 		// Call handler
+		start := time.Now()
 		reply := handler(ctx)
+		if config.OnMessageHandled != nil {
+			config.OnMessageHandled(client.Id, messageEvent(wsData), time.Since(start))
+		}
+
+		// Stop reading if the handler took over the connection
+		if client.detached.Load() {
+			return
+		}
 
 		// Send reply if not nil
 		if reply != nil {
-			client.Send(reply)
+			ctx.Reply(reply)
 		}
 	}
 }
 
+// messageEvent names a message by its "type" or "cmd" field
+func messageEvent(data WsData) string {
+	if event := data.String("type"); event != "" {
+		return event
+	}
+	if event := data.String("cmd"); event != "" {
+		return event
+	}
+	return "message"
+}
+
 // writePump writes messages to the WebSocket connection
 func writePump(client *Client, config *WsConfig) {
 	ticker := time.NewTicker(config.PingInterval)
 	defer func() {
 		ticker.Stop()
-		client.conn.Close()
+		if !client.detached.Load() {
+			client.conn.Close()
+		}
+		close(client.writerDone)
 	}()
 
 	for {
 		select {
+		case <-client.detach:
+			return
+
 		case message, ok := <-client.send:
 			client.conn.SetWriteDeadline(time.Now().Add(config.WriteWait))
 			if !ok {
-				client.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				payload := []byte{}
+				if client.closeCode != 0 {
+					payload = websocket.FormatCloseMessage(client.closeCode, "")
+				}
+				client.conn.WriteMessage(websocket.CloseMessage, payload)
 				return
 			}
 
-			if err := client.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			frame := websocket.TextMessage
+			if client.binary {
+				frame = websocket.BinaryMessage
+			}
+			if err := client.conn.WriteMessage(frame, message); err != nil {
 				return
 			}
 
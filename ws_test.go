@@ -0,0 +1,426 @@
+package microweb
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testClient is a hub client without a connection whose messages are
+// counted by a reader goroutine, like a long-poll client that never stops
+// polling
+type testClient struct {
+	*Client
+	expected atomic.Int64 // messages sent to the client
+	received atomic.Int64
+	drained  chan struct{} // closed when the send channel is closed
+}
+
+func newTestClient(hub *WsHub, id string) *testClient {
+	tc := &testClient{
+		Client: &Client{
+			Id:     id,
+			send:   make(chan []byte, 256),
+			done:   make(chan struct{}),
+			hub:    hub,
+			events: make(map[string][]EventHandler),
+		},
+		drained: make(chan struct{}),
+	}
+	go func() {
+		defer close(tc.drained)
+		for range tc.send {
+			tc.received.Add(1)
+		}
+	}()
+	return tc
+}
+
+func newTestHub(t *testing.T, config *WsConfig, n int) (*WsHub, []*testClient) {
+	t.Helper()
+
+	hub := NewWsHub(config)
+	go hub.Run()
+
+	clients := make([]*testClient, n)
+	for i := range clients {
+		clients[i] = newTestClient(hub, fmt.Sprintf("client-%d", i))
+		queue(hub.register, clients[i].Client, &hub.registerCount)
+	}
+	waitFor(t, func() bool { return hub.Count() == n })
+	return hub, clients
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestClientSendStress sends to clients from many goroutines through every
+// send path while some clients are closed. Run it with -race. Every client
+// must either receive every message sent to it or be disconnected.
+func TestClientSendStress(t *testing.T) {
+	const (
+		numClients = 16
+		senders    = 8
+		perSender  = 200
+		broadcasts = 100
+	)
+
+	hub, clients := newTestHub(t, DefaultWsConfig(), numClients)
+
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		// Direct sends from many goroutines
+		for s := 0; s < senders; s++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for m := 0; m < perSender; m++ {
+					c.expected.Add(1)
+					c.Send(WsData{"n": m})
+				}
+			}()
+		}
+
+		// Hub.Send by id
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := 0; m < perSender; m++ {
+				c.expected.Add(1)
+				hub.Send(c.Id, "hub")
+			}
+		}()
+
+		// Close every fourth client part way through
+		if i%4 == 0 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				time.Sleep(time.Millisecond)
+				if i%8 == 0 {
+					c.Close()
+				} else {
+					hub.Close(c.Id)
+				}
+			}()
+		}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for m := 0; m < broadcasts; m++ {
+			for _, c := range clients {
+				c.expected.Add(1)
+			}
+			hub.Broadcast("all")
+		}
+	}()
+	wg.Wait()
+
+	// Hub sends and broadcasts are delivered asynchronously
+	for _, c := range clients {
+		waitFor(t, func() bool {
+			return c.isClosed() || c.received.Load() == c.expected.Load()
+		})
+	}
+
+	closed := 0
+	for i, c := range clients {
+		if c.isClosed() {
+			closed++
+			// A disconnected client's channel is closed, so its reader
+			// sees the end of the stream rather than silence
+			select {
+			case <-c.drained:
+			case <-time.After(time.Second):
+				t.Errorf("client %d closed but its send channel is still open", i)
+			}
+			continue
+		}
+
+		if got, want := c.received.Load(), c.expected.Load(); got != want {
+			t.Errorf("client %d received %d of %d messages without being disconnected", i, got, want)
+		}
+	}
+
+	if closed < numClients/4 {
+		t.Errorf("%d clients closed, want at least %d", closed, numClients/4)
+	}
+	if got := hub.Count(); got != numClients-closed {
+		t.Errorf("hub has %d clients, want %d", got, numClients-closed)
+	}
+}
+
+// TestClientOverflowDisconnects checks that a client that stops reading is
+// disconnected instead of losing messages
+func TestClientOverflowDisconnects(t *testing.T) {
+	hub := NewWsHub(DefaultWsConfig())
+	go hub.Run()
+
+	c := &Client{
+		Id:     "stalled",
+		send:   make(chan []byte, 4),
+		done:   make(chan struct{}),
+		hub:    hub,
+		events: make(map[string][]EventHandler),
+	}
+	queue(hub.register, c, &hub.registerCount)
+	waitFor(t, func() bool { return hub.Count() == 1 })
+
+	var wg sync.WaitGroup
+	for s := 0; s < 8; s++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := 0; m < 50; m++ {
+				c.Send("x")
+			}
+		}()
+	}
+	wg.Wait()
+
+	waitFor(t, func() bool { return hub.Count() == 0 && c.isClosed() })
+}
+
+// TestBackpressureBlockDoesNotStallHub checks that a Hub.Send waiting for
+// room in a stalled client's buffer doesn't hold up sends to other clients,
+// and that the stalled client gets its messages in order once it reads
+func TestBackpressureBlockDoesNotStallHub(t *testing.T) {
+	config := DefaultWsConfig()
+	config.BackpressurePolicy = BackpressureBlock
+	config.BackpressureTimeout = 10 * time.Second
+	hub, clients := newTestHub(t, config, 1)
+
+	stalled := &Client{
+		Id:     "stalled",
+		send:   make(chan []byte, 2),
+		done:   make(chan struct{}),
+		hub:    hub,
+		events: make(map[string][]EventHandler),
+	}
+	queue(hub.register, stalled, &hub.registerCount)
+	waitFor(t, func() bool { return hub.Count() == 2 })
+
+	for i := 0; i < 4; i++ {
+		hub.Send(stalled.Id, fmt.Sprint(i))
+	}
+	hub.Send(clients[0].Id, "other")
+	waitFor(t, func() bool { return clients[0].received.Load() == 1 })
+
+	for i := 0; i < 4; i++ {
+		if got := string(<-stalled.send); got != fmt.Sprint(i) {
+			t.Fatalf("message %d = %q, want %q", i, got, fmt.Sprint(i))
+		}
+	}
+	if hub.Count() != 2 {
+		t.Fatalf("Count = %d, want 2", hub.Count())
+	}
+}
+
+// BenchmarkRegisterDuringBroadcast measures how long a new client takes to
+// join the hub while a broadcast to 50,000 clients is being delivered. It
+// reports the median as ns/register; ns/op is the time to deliver one
+// broadcast to every client. Each broadcast is delivered before the next is
+// sent: broadcasting faster than the workers deliver fills their queues and
+// then holds up the hub's Run loop, registers included.
+func BenchmarkRegisterDuringBroadcast(b *testing.B) {
+	const numClients = 50000
+
+	hub := NewWsHub(DefaultWsConfig())
+	go hub.Run()
+
+	var delivered atomic.Int64
+	for i := 0; i < numClients; i++ {
+		c := &Client{
+			Id:     fmt.Sprintf("client-%d", i),
+			send:   make(chan []byte, 256),
+			done:   make(chan struct{}),
+			hub:    hub,
+			events: make(map[string][]EventHandler),
+		}
+		go func() {
+			for range c.send {
+				delivered.Add(1)
+			}
+		}()
+		queue(hub.register, c, &hub.registerCount)
+	}
+	for hub.Count() < numClients {
+		time.Sleep(time.Millisecond)
+	}
+
+	message := []byte(`{"type":"tick"}`)
+	latencies := make([]time.Duration, 0, b.N)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hub.Broadcast(message)
+
+		c := &Client{
+			Id:     fmt.Sprintf("late-%d", i),
+			send:   make(chan []byte, 256),
+			done:   make(chan struct{}),
+			hub:    hub,
+			events: make(map[string][]EventHandler),
+		}
+		start := time.Now()
+		queue(hub.register, c, &hub.registerCount)
+		for hub.GetClient(c.Id) == nil {
+			runtime.Gosched()
+		}
+		latencies = append(latencies, time.Since(start))
+
+		queue(hub.unregister, c, &hub.unregisterCount)
+
+		for delivered.Load() < int64(numClients*(i+1)) {
+			runtime.Gosched()
+		}
+	}
+	b.StopTimer()
+
+	slices.Sort(latencies)
+	b.ReportMetric(float64(latencies[len(latencies)/2].Nanoseconds()), "ns/register")
+}
+
+// TestBlockedBroadcastDoesNotStallRegister checks that broadcasts queued
+// behind a stalled client under BackpressureBlock don't stop new clients from
+// joining the hub
+func TestBlockedBroadcastDoesNotStallRegister(t *testing.T) {
+	config := DefaultWsConfig()
+	config.BackpressurePolicy = BackpressureBlock
+	config.BackpressureTimeout = 10 * time.Second
+	config.BroadcastWorkers = 1
+	hub := NewWsHub(config)
+	go hub.Run()
+
+	stalled := &Client{
+		Id:     "stalled",
+		send:   make(chan []byte, 1),
+		done:   make(chan struct{}),
+		hub:    hub,
+		events: make(map[string][]EventHandler),
+	}
+	queue(hub.register, stalled, &hub.registerCount)
+	waitFor(t, func() bool { return hub.Count() == 1 })
+
+	// More than the shard's 64 job slots, all stuck behind the stalled client
+	const n = 200
+	for i := 0; i < n; i++ {
+		hub.Broadcast(fmt.Sprint(i))
+	}
+
+	late := newTestClient(hub, "late")
+	queue(hub.register, late.Client, &hub.registerCount)
+	waitFor(t, func() bool { return hub.Count() == 2 })
+
+	for i := 0; i < n; i++ {
+		if got := string(<-stalled.send); got != fmt.Sprint(i) {
+			t.Fatalf("broadcast %d = %q, want %q", i, got, fmt.Sprint(i))
+		}
+	}
+}
+
+// TestOnDisconnectRunsBeforeLeavingHub checks that OnDisconnect hooks still
+// see the client in the hub, both when the connection closes and when a
+// handler detaches it
+func TestOnDisconnectRunsBeforeLeavingHub(t *testing.T) {
+	hub := NewWsHub(DefaultWsConfig())
+	go hub.Run()
+
+	inHub := make(chan bool, 2)
+	hub.OnDisconnect(func(c *Client) {
+		// Give an already queued unregister time to run
+		time.Sleep(20 * time.Millisecond)
+		hub.mu.RLock()
+		inHub <- hub.clients[c.Id] == c
+		hub.mu.RUnlock()
+	})
+
+	r := New()
+	r.Get("/ws", func(ctx *Context) {
+		serveWs(hub, ctx, nil, func(ctx *ClientContext) WsData {
+			if ctx.Data.Get("detach") == true {
+				ctx.Detach().Close()
+			}
+			return nil
+		}, nil)
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	url := "ws" + srv.URL[len("http"):] + "/ws"
+
+	for _, detach := range []bool{false, true} {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, func() bool { return hub.Count() == 1 })
+
+		if detach {
+			conn.WriteJSON(WsData{"detach": true})
+		} else {
+			conn.Close()
+		}
+		select {
+		case ok := <-inHub:
+			if !ok {
+				t.Errorf("detach=%v: client had left the hub before OnDisconnect", detach)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("detach=%v: OnDisconnect not called", detach)
+		}
+		conn.Close()
+		waitFor(t, func() bool { return hub.Count() == 0 })
+	}
+}
+
+// TestJoinAfterDisconnectDoesNotLeak checks that a handler joining a room
+// after its client was dropped leaves no membership behind
+func TestJoinAfterDisconnectDoesNotLeak(t *testing.T) {
+	hub, clients := newTestHub(t, DefaultWsConfig(), 1)
+	c := clients[0]
+
+	hub.Close(c.Id)
+	<-c.drained
+
+	ctx := &ClientContext{Id: c.Id, client: c.Client}
+	ctx.Join("lobby")
+	if members := hub.RoomMembers("lobby"); len(members) != 0 {
+		t.Fatalf("RoomMembers = %v, want none", members)
+	}
+}
+
+// TestSubscribeAfterDisconnectDoesNotLeak is TestJoinAfterDisconnectDoesNotLeak
+// for topics
+func TestSubscribeAfterDisconnectDoesNotLeak(t *testing.T) {
+	hub, clients := newTestHub(t, DefaultWsConfig(), 1)
+	c := clients[0]
+
+	hub.Close(c.Id)
+	<-c.drained
+
+	c.Subscribe("news", nil)
+	hub.mu.RLock()
+	n := len(hub.topics["news"])
+	hub.mu.RUnlock()
+	if n != 0 {
+		t.Fatalf("topic has %d subscribers, want none", n)
+	}
+}
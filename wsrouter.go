@@ -0,0 +1,71 @@
+package microweb
+
+import "strings"
+
+// WsRouter dispatches WebSocket messages to handlers by the value of a
+// command field. Register it with router.Ws("/ws", wsRouter.Dispatch).
+// Handlers must be registered before the router starts serving.
+type WsRouter struct {
+	field    []string
+	handlers map[string]WsHandler
+	fallback WsHandler
+}
+
+// NewWsRouter creates a message router. Until CommandField is called the
+// command is read from "type", falling back to "cmd".
+func NewWsRouter() *WsRouter {
+	return &WsRouter{handlers: make(map[string]WsHandler)}
+}
+
+// CommandField sets the field holding the command. A dotted path such as
+// "meta.type" reads a field of a nested object.
+func (wr *WsRouter) CommandField(path string) *WsRouter {
+	wr.field = strings.Split(path, ".")
+	return wr
+}
+
+// Handle registers the handler for a command
+func (wr *WsRouter) Handle(command string, handler WsHandler) *WsRouter {
+	wr.handlers[command] = handler
+	return wr
+}
+
+// Default sets the handler for messages whose command has no handler or is
+// missing. Without one such messages are ignored.
+func (wr *WsRouter) Default(handler WsHandler) *WsRouter {
+	wr.fallback = handler
+	return wr
+}
+
+// Command returns the command of a message, or "" when the field is missing
+// or not a string
+func (wr *WsRouter) Command(data WsData) string {
+	if wr.field == nil {
+		if cmd := data.String("type"); cmd != "" {
+			return cmd
+		}
+		return data.String("cmd")
+	}
+
+	var v any = map[string]any(data)
+	for _, key := range wr.field {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return ""
+		}
+		v = m[key]
+	}
+	cmd, _ := v.(string)
+	return cmd
+}
+
+// Dispatch calls the handler registered for the message's command
+func (wr *WsRouter) Dispatch(ctx *ClientContext) WsData {
+	if handler, ok := wr.handlers[wr.Command(ctx.Data)]; ok {
+		return handler(ctx)
+	}
+	if wr.fallback != nil {
+		return wr.fallback(ctx)
+	}
+	return nil
+}